@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+)
+
+// Changed reports whether the remote archive has changed since its size was
+// determined, so that a long-lived cache of RemoteZipFile values knows when
+// to reopen one instead of serving stale offsets. It sends a conditional
+// MetadataMethod request (If-None-Match with the ETag, or else
+// If-Modified-Since with the Last-Modified time seen then), which the server
+// answers with 304 Not Modified and no body when nothing changed. Servers
+// that ignore the condition are checked by comparing validators and size.
+// Without either validator, only a change of size is detected, as it is for
+// archives opened with NewFromFetcher. Archives opened with NewFromReader or
+// NewFromReaderAt never report a change; small archives buffered per
+// SmallFileThreshold are checked as usual.
+// Detecting a change empties the ContentCacheSize cache.
+func (rzf *RemoteZipFile) Changed(ctx context.Context) (bool, error) {
+	st := rzf.state()
+	if st.local != nil && !st.buffered {
+		return false, nil
+	}
+
+	changed, err := rzf.checkChanged(ctx, st)
+	if changed && st.contents != nil {
+		st.contents.reset()
+	}
+	return changed, err
+}
+
+// checkChanged makes the request of Changed, comparing with st
+func (rzf *RemoteZipFile) checkChanged(ctx context.Context, st archiveState) (bool, error) {
+	if !rzf.overHTTP() {
+		size, err := rzf.fetcher.Size(ctx)
+		return err == nil && size != cmp.Or(st.gzipSize, st.size), err
+	}
+
+	// A plain GET would download the whole archive, so ask for one byte
+	method := rzf.opts.metadataMethod()
+	ranged := method == http.MethodGet
+	if ranged {
+		method = rzf.opts.rangeMethod()
+	}
+	req, err := newRequest(method, rzf.URL, rzf.opts.Header)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	if ranged {
+		rzf.opts.setRange(req, 0, 0)
+	}
+	if st.etag != "" {
+		req.Header.Set("If-None-Match", st.etag)
+	} else if st.lastModified != "" {
+		req.Header.Set("If-Modified-Since", st.lastModified)
+	}
+
+	resp, err := rzf.do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	var size int64
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+		size = resp.ContentLength
+	case http.StatusPartialContent:
+		_, _, size, err = parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+
+	// A gunzipped archive is compared with the size of the download
+	if size >= 0 && size != cmp.Or(st.gzipSize, st.size) {
+		return true, nil
+	}
+	if st.etag != "" {
+		return resp.Header.Get("ETag") != st.etag, nil
+	}
+	return st.lastModified != "" && resp.Header.Get("Last-Modified") != st.lastModified, nil
+}
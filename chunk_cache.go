@@ -0,0 +1,150 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// chunkCache keeps the most recently used ChunkSize-aligned blocks of the
+// archive, keyed by block index. It is safe for concurrent use.
+type chunkCache struct {
+	mu        sync.Mutex
+	capacity  int
+	lru       *list.List // of *chunk, most recently used first
+	index     map[int64]*list.Element
+	evictions int64
+}
+
+type chunk struct {
+	index int64
+	data  []byte
+}
+
+func newChunkCache(capacity int) *chunkCache {
+	if capacity <= 0 {
+		capacity = defaultChunkCacheSize
+	}
+	return &chunkCache{
+		capacity: capacity,
+		lru:      list.New(),
+		index:    map[int64]*list.Element{},
+	}
+}
+
+// get returns the cached data of chunk i
+func (c *chunkCache) get(i int64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[i]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*chunk).data, true
+}
+
+// has reports whether chunk i is cached without marking it as used
+func (c *chunkCache) has(i int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.index[i]
+	return ok
+}
+
+// put caches the data of chunk i, evicting the least recently used chunk
+// when the cache is full
+func (c *chunkCache) put(i int64, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.index[i]; ok {
+		elem.Value.(*chunk).data = data
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.index[i] = c.lru.PushFront(&chunk{index: i, data: data})
+	if c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.index, oldest.Value.(*chunk).index)
+		c.evictions++
+	}
+}
+
+// evictionCount returns how many chunks put has evicted
+func (c *chunkCache) evictionCount() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evictions
+}
+
+// reset drops every cached chunk
+func (c *chunkCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.index = map[int64]*list.Element{}
+}
+
+// getChunkedRange serves [start, end) from ChunkSize-aligned blocks, fetching
+// each run of consecutive missing blocks with a single request. The final
+// block of the archive, whose size is total, may be shorter than ChunkSize.
+func (rzf *RemoteZipFile) getChunkedRange(ctx context.Context, chunks *chunkCache, total, start, end int64) ([]byte, error) {
+	size := rzf.opts.ChunkSize
+	first, last := start/size, (end-1)/size
+	blocks := make([][]byte, last-first+1)
+	cached := make([]bool, len(blocks))
+
+	for i := first; i <= last; {
+		if data, ok := chunks.get(i); ok {
+			blocks[i-first] = data
+			cached[i-first] = true
+			rzf.stats.cacheHits.Add(1)
+			i++
+			continue
+		}
+
+		j := i
+		for j < last && !chunks.has(j+1) {
+			j++
+		}
+		rzf.stats.cacheMisses.Add(j - i + 1)
+
+		data, err := rzf.fetch(ctx, i*size, min((j+1)*size, total))
+		if err != nil {
+			return nil, err
+		}
+
+		for k := i; k <= j; k++ {
+			lo := (k - i) * size
+			if lo >= int64(len(data)) {
+				break
+			}
+			hi := min(lo+size, int64(len(data)))
+			blocks[k-first] = data[lo:hi:hi]
+			chunks.put(k, blocks[k-first])
+		}
+		i = j + 1
+	}
+
+	buf := make([]byte, 0, end-start)
+	for k, data := range blocks {
+		base := (first + int64(k)) * size
+		lo := max(start-base, 0)
+		hi := min(end-base, int64(len(data)))
+		if lo >= hi {
+			break
+		}
+		if cached[k] {
+			rzf.stats.bytesFromCache.Add(hi - lo)
+		}
+		buf = append(buf, data[lo:hi]...)
+	}
+	return buf, nil
+}
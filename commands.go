@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// cliFlags holds the command-line flags of all commands. Each command
+// registers the groups relevant to it; the flat legacy form registers all.
+type cliFlags struct {
+	excludes             patternList
+	manifest             string
+	quiet                bool
+	decodeNames          bool
+	normalizeBackslashes bool
+	gunzip               bool
+	passwordStdin        bool
+	maxConnections       int
+	chunkSize            int64
+	showStats            bool
+	listLong             bool
+	tree                 bool
+	checksum             bool
+	recreateStructure    bool
+	writeStdout          bool
+	pipe                 bool
+	stripComponents      int
+	noDirCreation        bool
+	selectLargest        bool
+	selectSmallest       bool
+	contentType          string
+	minSize              string
+	maxSize              string
+	keepGoing            bool
+	journalPath          string
+	resume               bool
+	resumeFile           bool
+	repack               string
+	newerOnly            bool
+	onCollision          string
+	sortOrder            string
+	dirsFirst            bool
+	estimate             bool
+	ndjson               bool
+	listFiles            bool
+	testArchive          bool
+
+	// extractAll is set by the extract command, which extracts every file
+	// when no patterns are given
+	extractAll bool
+}
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	flags   func(o *cliFlags, fs *flag.FlagSet)
+}
+
+var commands = []command{
+	{"list", "List the files in the archive, or only those matching patterns", (*cliFlags).registerList},
+	{"extract", "Extract the files matching patterns, or all files if none are given", (*cliFlags).registerExtract},
+	{"test", "Check that the matching files (all if none are given) decompress and match their CRC-32", nil},
+}
+
+// parseCommandLine parses args, which start with a command or else are in
+// the original flat form driven by -l, -t and the extraction flags. It
+// returns the flags and the remaining arguments, the url first.
+func parseCommandLine(args []string) (cliFlags, []string) {
+	// Defaults of flags that not every command registers
+	o := cliFlags{sortOrder: "archive", onCollision: "overwrite"}
+	if len(args) > 0 {
+		for _, cmd := range commands {
+			if args[0] == cmd.name {
+				return o, o.parseCommand(cmd, args[1:])
+			}
+		}
+	}
+
+	o.registerCommon(flag.CommandLine)
+	o.registerList(flag.CommandLine)
+	o.registerExtract(flag.CommandLine)
+	o.registerLegacy(flag.CommandLine)
+	flag.Parse()
+	return o, flag.Args()
+}
+
+// parseCommand parses the arguments following cmd with a flag set of its
+// own, exiting with its usage if the url is missing
+func (o *cliFlags) parseCommand(cmd command, args []string) []string {
+	fs := flag.NewFlagSet("unzip-http "+cmd.name, flag.ExitOnError)
+	o.registerCommon(fs)
+	if cmd.flags != nil {
+		cmd.flags(o, fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: unzip-http %s [options] <url> [patterns...]\n\n", cmd.name)
+		fmt.Fprintf(os.Stderr, "%s.\n\nOptions:\n", cmd.summary)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	switch cmd.name {
+	case "list":
+		o.listFiles = true
+	case "extract":
+		o.extractAll = true
+	case "test":
+		o.testArchive = true
+	}
+	return fs.Args()
+}
+
+// registerCommon registers the flags every command takes
+func (o *cliFlags) registerCommon(fs *flag.FlagSet) {
+	fs.Var(&o.excludes, "x", "Exclude files matching `pattern` (repeatable)")
+	fs.StringVar(&o.manifest, "from-file", "", "Extract the files named or matched by each line of `manifest`")
+	fs.BoolVar(&o.quiet, "q", false, "Suppress per-file progress messages")
+	fs.BoolVar(&o.quiet, "quiet", false, "Suppress per-file progress messages")
+	fs.BoolVar(&o.decodeNames, "decode-names", false, "Decode non-UTF-8 entry names as CP437")
+	fs.BoolVar(&o.normalizeBackslashes, "normalize-backslashes", false, "Treat backslashes in entry names as path separators")
+	fs.BoolVar(&o.gunzip, "gunzip", false, "Download and decompress gzip-compressed archives (.zip.gz) in memory")
+	fs.BoolVar(&o.passwordStdin, "password-stdin", false, "Read the password of encrypted files from the first line of stdin")
+	fs.IntVar(&o.maxConnections, "max-connections", 0, "Maximum number of connections to the server")
+	fs.Int64Var(&o.chunkSize, "chunk-size", 0, "Fetch and cache the archive in aligned blocks of N bytes")
+	fs.BoolVar(&o.showStats, "stats", false, "Print request, download and cache statistics when done")
+}
+
+// registerList registers the flags of listing
+func (o *cliFlags) registerList(fs *flag.FlagSet) {
+	fs.BoolVar(&o.listLong, "list-long", false, "List files with the byte range of their compressed data")
+	fs.BoolVar(&o.tree, "tree", false, "List files as an indented directory tree")
+	fs.BoolVar(&o.checksum, "checksum", false, "Add a CRC-32 column to the listing")
+}
+
+// registerExtract registers the flags of extraction
+func (o *cliFlags) registerExtract(fs *flag.FlagSet) {
+	fs.BoolVar(&o.recreateStructure, "f", false, "Recreate folder structure from .zip file when extracting")
+	fs.BoolVar(&o.writeStdout, "o", false, "Write files to stdout")
+	fs.BoolVar(&o.pipe, "p", false, "Write the single matching file to stdout with no other output")
+	fs.IntVar(&o.stripComponents, "strip-components", 0, "Remove N leading path components when extracting with -f")
+	fs.BoolVar(&o.noDirCreation, "no-directory-creation", false, "Fail instead of creating missing output directories")
+	fs.BoolVar(&o.selectLargest, "select-largest", false, "Only extract the largest matching file")
+	fs.BoolVar(&o.selectSmallest, "select-smallest", false, "Only extract the smallest matching file")
+	fs.StringVar(&o.contentType, "content-type", "", "Only extract files whose detected MIME type starts with `prefix`")
+	fs.StringVar(&o.minSize, "min-size", "", "Only extract files of at least `size` bytes (e.g. 500k, 1M)")
+	fs.StringVar(&o.maxSize, "max-size", "", "Only extract files of at most `size` bytes (e.g. 500k, 1M)")
+	fs.BoolVar(&o.keepGoing, "keep-going", false, "Skip files that fail to extract and report them at the end")
+	fs.StringVar(&o.journalPath, "journal", "", "Record extracted files in `file` so an interrupted extraction can be resumed")
+	fs.BoolVar(&o.resume, "resume", false, "With --journal, skip files the journal records as extracted")
+	fs.BoolVar(&o.resumeFile, "resume-file", false, "Extract the single matching file, continuing a partial output file if stored")
+	fs.StringVar(&o.repack, "repack", "", "Copy the matching entries, still compressed, into a new local zip `file`")
+	fs.BoolVar(&o.newerOnly, "newer-only", false, "Skip entries not newer than the existing output file")
+	fs.StringVar(&o.onCollision, "on-collision", "overwrite", "Without -f, `policy` for files sharing a name: overwrite, rename or error")
+	fs.StringVar(&o.sortOrder, "sort", "archive", "Extract in `order`: archive, name or size")
+	fs.BoolVar(&o.dirsFirst, "dirs-first", false, "Extract directory entries before files")
+	fs.BoolVar(&o.estimate, "estimate", false, "Print how many bytes extracting the matching files would download, and exit")
+	fs.BoolVar(&o.ndjson, "ndjson", false, "Print a JSON object per extracted, skipped or failed file to stdout")
+}
+
+// registerLegacy registers the flags that select the mode in the flat form,
+// which the commands replace
+func (o *cliFlags) registerLegacy(fs *flag.FlagSet) {
+	fs.BoolVar(&o.listFiles, "l", false, "List files in remote .zip file")
+	fs.BoolVar(&o.testArchive, "t", false, "Test that the files decompress and match their CRC-32, writing nothing")
+	fs.BoolVar(&o.testArchive, "test", false, "Test that the files decompress and match their CRC-32, writing nothing")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+)
+
+// contentCache keeps the decompressed contents of the most recently
+// extracted entries, keyed by name, up to a total of capacity bytes. It is
+// safe for concurrent use.
+type contentCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	lru      *list.List // of *cachedContent, most recently used first
+	index    map[string]*list.Element
+}
+
+type cachedContent struct {
+	name string
+	data []byte
+}
+
+func newContentCache(capacity int64) *contentCache {
+	return &contentCache{
+		capacity: capacity,
+		lru:      list.New(),
+		index:    map[string]*list.Element{},
+	}
+}
+
+// get returns a copy of the cached contents of name
+func (c *contentCache) get(name string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.index[name]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return bytes.Clone(elem.Value.(*cachedContent).data), true
+}
+
+// put caches a copy of data as the contents of name, evicting the least
+// recently used entries until the total fits. Contents larger than the
+// whole cache are not cached.
+func (c *contentCache) put(name string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if int64(len(data)) > c.capacity {
+		return
+	}
+	if elem, ok := c.index[name]; ok {
+		c.size -= int64(len(elem.Value.(*cachedContent).data))
+		c.lru.Remove(elem)
+	}
+
+	c.index[name] = c.lru.PushFront(&cachedContent{name: name, data: bytes.Clone(data)})
+	c.size += int64(len(data))
+	for c.size > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		content := oldest.Value.(*cachedContent)
+		delete(c.index, content.name)
+		c.size -= int64(len(content.data))
+	}
+}
+
+// reset drops every cached entry
+func (c *contentCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.index = map[string]*list.Element{}
+	c.size = 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// zip64LocatorSignature starts the ZIP64 end of central directory locator
+const zip64LocatorSignature = 0x07064b50
+
+// DiskInfo holds the disk fields of the End of Central Directory record.
+// They number the segments of a split (spanned) archive from 0, so an
+// archive written in one piece has both disk numbers 0 and all of its
+// entries on that disk.
+type DiskInfo struct {
+	// Disk is the number of the segment holding the EOCD record, which is
+	// the last one
+	Disk int
+
+	// DirectoryDisk is the number of the segment the central directory
+	// starts on
+	DirectoryDisk int
+
+	// EntriesOnDisk is how many central directory entries the EOCD record
+	// counts on this segment, or -1 if only the ZIP64 end record has it
+	EntriesOnDisk int
+
+	// TotalDisks is the number of segments the ZIP64 end of central
+	// directory locator records, or 0 if the archive has no locator
+	TotalDisks int
+}
+
+// parseDiskInfo reads the disk fields of the EOCD record at eocdPos in
+// endData and of the ZIP64 locator before it, if any
+func parseDiskInfo(endData []byte, eocdPos int) DiskInfo {
+	eocd := endData[eocdPos:]
+	info := DiskInfo{
+		Disk:          int(binary.LittleEndian.Uint16(eocd[4:6])),
+		DirectoryDisk: int(binary.LittleEndian.Uint16(eocd[6:8])),
+		EntriesOnDisk: int(binary.LittleEndian.Uint16(eocd[8:10])),
+	}
+	if info.EntriesOnDisk == 0xFFFF {
+		info.EntriesOnDisk = -1
+	}
+	if locatorPos := eocdPos - 20; locatorPos >= 0 && binary.LittleEndian.Uint32(endData[locatorPos:]) == zip64LocatorSignature {
+		info.TotalDisks = int(binary.LittleEndian.Uint32(endData[locatorPos+16:]))
+		// The 16-bit fields are saturated when the ZIP64 end record holds
+		// the real disk numbers. The locator's count implies the last one;
+		// where the directory starts is only in the record, which split
+		// archives this large are too rare to fetch for.
+		if info.Disk == 0xFFFF {
+			info.Disk = max(info.TotalDisks-1, 0)
+		}
+		if info.DirectoryDisk == 0xFFFF {
+			info.DirectoryDisk = info.Disk
+		}
+	}
+	return info
+}
+
+// check rejects the final segment of a split archive, whose other
+// segments are not available: its entries' offsets are relative to the
+// segment each starts on, and the central directory may begin on an earlier
+// one. totalEntries is the EOCD's total entry count.
+func (info DiskInfo) check(totalEntries uint16) error {
+	switch {
+	case info.Disk != info.DirectoryDisk:
+		return fmt.Errorf("%w: this is disk %d, the central directory starts on disk %d",
+			ErrSpannedArchive, info.Disk, info.DirectoryDisk)
+	case info.EntriesOnDisk >= 0 && totalEntries != 0xFFFF && info.EntriesOnDisk != int(totalEntries):
+		return fmt.Errorf("%w: %d of %d central directory entries are on this disk",
+			ErrSpannedArchive, info.EntriesOnDisk, totalEntries)
+	case info.Disk != 0 || info.TotalDisks > 1:
+		return fmt.Errorf("%w: this is disk %d of a split archive", ErrSpannedArchive, info.Disk)
+	}
+	return nil
+}
+
+// Disks returns the disk fields of the archive's End of Central Directory
+// record. Archives that are one segment of a split fail to load with
+// ErrSpannedArchive, so for a loaded archive the disk numbers are 0.
+func (rzf *RemoteZipFile) Disks() DiskInfo {
+	return rzf.state().disks
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned (wrapped) by RemoteZipFile so callers can use
+// errors.Is to tell common failures apart
+var (
+	// ErrNotFound is returned when the requested entry is not in the archive
+	ErrNotFound = errors.New("file not found")
+
+	// ErrRangeUnsupported is returned when the server cannot serve byte ranges
+	ErrRangeUnsupported = errors.New("server does not support range requests")
+
+	// ErrFileChanged is returned when the remote archive changed size while in use
+	ErrFileChanged = errors.New("remote file changed")
+
+	// ErrUnsupportedMethod is returned when an entry uses a compression method
+	// with no registered decompressor
+	ErrUnsupportedMethod = errors.New("unsupported compression method")
+
+	// ErrTooLarge is returned when an entry decompresses to more than
+	// Options.MaxDecompressedSize bytes
+	ErrTooLarge = errors.New("file exceeds size limit")
+
+	// ErrUnexpectedSize is returned when an entry ends before (or after) the
+	// uncompressed size recorded in the central directory
+	ErrUnexpectedSize = errors.New("unexpected size")
+
+	// ErrNotZip is returned when the URL does not point to a ZIP archive,
+	// e.g. an HTML page or a .tar.gz
+	ErrNotZip = errors.New("URL does not appear to be a ZIP file")
+
+	// ErrChecksumMismatch is returned when extracted data does not match the
+	// digest supplied in Options.ExpectedSHA256
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrEncrypted is returned when opening an encrypted entry without
+	// Options.Password, or one using WinZip AES encryption, which is not
+	// supported
+	ErrEncrypted = errors.New("file is encrypted")
+
+	// ErrWrongPassword is returned when Options.Password does not decrypt
+	// an encrypted entry
+	ErrWrongPassword = errors.New("incorrect password")
+
+	// ErrUnsafeEntry is returned under Options.Strict for symbolic links and
+	// names that could escape a destination directory
+	ErrUnsafeEntry = errors.New("unsafe entry")
+
+	// ErrSpannedArchive is returned when the archive is the last segment of
+	// a split (spanned) archive whose other segments are not available
+	ErrSpannedArchive = errors.New("spanned archive segment missing")
+
+	// ErrGzipped is returned when the URL serves a gzip-compressed archive
+	// (.zip.gz), whose ZIP offsets cannot be reached with range requests.
+	// See Options.GunzipFallback.
+	ErrGzipped = errors.New("URL is gzip-compressed; ranges not supported, download and decompress first")
+)
+
+// errNotIndexed is returned by lookups before the central directory is
+// loaded under Options.DeferIndex
+var errNotIndexed = errors.New("central directory not loaded; call LoadIndexContext first")
+
+// HTTPStatusError is returned when the server responds with an unexpected
+// HTTP status code, e.g. 401/403 for authentication failures
+type HTTPStatusError struct {
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+)
+
+// localHeaderReadSize is what opening an entry reads of its local header:
+// the fixed part, from which the offset of the data is computed
+const localHeaderReadSize = 30
+
+// EstimateDownload returns about how many bytes extracting the files that
+// match any of patterns (every file if there are none) and none of excludes
+// would download,
+// computed from the central directory alone: each file's compressed size
+// plus the fixed part of its local header, which is read to locate the data.
+// The central directory itself was downloaded when the archive was opened
+// and is not included. Retries, ChunkSize rounding and seeking backwards in
+// compressed files can add to the real figure. It fails with an error
+// wrapping ErrNotFound if a pattern matches nothing, excluded files included.
+func (rzf *RemoteZipFile) EstimateDownload(patterns []string, excludes ...string) (int64, error) {
+	st := rzf.state()
+	if !st.indexed {
+		return 0, errNotIndexed
+	}
+
+	var total int64
+	matched := make([]bool, len(patterns))
+	for _, f := range st.files {
+		name := rzf.DisplayName(f)
+		selected := len(patterns) == 0
+		for i, pattern := range patterns {
+			if matchPattern(pattern, name) {
+				matched[i] = true
+				selected = true
+			}
+		}
+		for _, pattern := range excludes {
+			if matchPattern(pattern, name) {
+				selected = false
+			}
+		}
+		if selected {
+			total += downloadSize(f)
+		}
+	}
+
+	for i, ok := range matched {
+		if !ok {
+			return 0, fmt.Errorf("no files matched pattern %s: %w", patterns[i], ErrNotFound)
+		}
+	}
+	return total, nil
+}
+
+// downloadSize estimates the bytes fetched to extract f, or 0 for a directory
+func downloadSize(f *zip.File) int64 {
+	if f.FileInfo().IsDir() {
+		return 0
+	}
+	return int64(f.CompressedSize64) + localHeaderReadSize
+}
@@ -47,10 +47,3 @@ func ExampleUsage() {
 	// Read from rc as needed...
 	fmt.Println("File opened successfully")
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteFS is the filesystem ExtractMatching writes to, so that extraction
+// can target an in-memory filesystem in tests or sandboxes. Paths use the
+// OS separator, as with the os package.
+type WriteFS interface {
+	MkdirAll(path string, perm fs.FileMode) error
+	// OpenFile opens a file for writing; flag is as for os.OpenFile
+	OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error)
+	// Stat fails for paths that do not exist
+	Stat(name string) (fs.FileInfo, error)
+	Chmod(name string, mode fs.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Remove(name string) error
+	// Rename replaces newpath with oldpath, atomically where the file
+	// system allows it, as os.Rename does
+	Rename(oldpath, newpath string) error
+}
+
+// OSFS is the WriteFS of the real filesystem, used when ExtractOptions.FS is
+// nil
+type OSFS struct{}
+
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// OverwritePolicy decides what ExtractMatching does when an output file
+// already exists
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways replaces existing files
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteNever keeps existing files and skips their entries
+	OverwriteNever
+	// OverwriteError fails with an error wrapping os.ErrExist
+	OverwriteError
+)
+
+// CollisionPolicy decides what ExtractMatching does when entries from
+// different directories flatten to the same output file
+type CollisionPolicy int
+
+const (
+	// CollisionOverwrite lets each entry replace the one written before it
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionRename writes each later entry with a numeric suffix before
+	// the extension, e.g. "config (1).json"
+	CollisionRename
+	// CollisionError fails each later entry
+	CollisionError
+)
+
+// ExtractOptions controls how ExtractMatching writes entries to disk
+type ExtractOptions struct {
+	// RecreateStructure keeps each entry's directories below the destination.
+	// Otherwise every file is written directly into it under its base name,
+	// and directory entries are skipped.
+	RecreateStructure bool
+
+	// StripComponents removes this many leading path components from each
+	// entry when RecreateStructure is set, like tar. Entries with no more
+	// components than that are skipped.
+	StripComponents int
+
+	// Overwrite decides what happens to existing files (default: replace)
+	Overwrite OverwritePolicy
+
+	// OnCollision decides what happens when, without RecreateStructure,
+	// several entries have the same base name and would be written to the
+	// same file (default: the last one wins). Only collisions among the
+	// entries of one extraction count; files that existed before are left
+	// to Overwrite.
+	OnCollision CollisionPolicy
+
+	// Renamed, if set, is called with an entry's name and the path it is
+	// written to instead when CollisionRename renames it
+	Renamed func(name, path string)
+
+	// NoDirectoryCreation makes extraction fail, rather than create the
+	// directory, when an entry's output directory does not exist, to catch
+	// mistakes in an expected layout. Directory entries then only have
+	// their metadata applied to directories that already exist.
+	NoDirectoryCreation bool
+
+	// NewerOnly skips, without downloading, entries whose modification time
+	// is not after that of the existing output file. Since extracted files
+	// take the entry's time, repeated runs only fetch what has changed.
+	NewerOnly bool
+
+	// Excludes lists patterns of entries to leave out even if they match
+	Excludes []string
+
+	// ContentType, if set, restricts extraction to files whose detected
+	// type (see RemoteZipFile.ContentType) starts with it, e.g. "image/".
+	// Each candidate costs an extra small range request, and directory
+	// entries are skipped.
+	ContentType string
+
+	// MinSize and MaxSize, if positive, restrict extraction to files whose
+	// uncompressed size recorded in the central directory is at least
+	// MinSize and at most MaxSize bytes. Directory entries are skipped.
+	MinSize, MaxSize int64
+
+	// Order and DirsFirst set the order in which entries are extracted;
+	// see SortedFiles
+	Order     SortOrder
+	DirsFirst bool
+
+	// Progress, if set, is called with each file's name before it is written
+	Progress func(name string)
+
+	// FS is written to instead of the real filesystem when set
+	FS WriteFS
+
+	// KeepGoing skips entries that fail to extract, e.g. because of an
+	// unsupported compression method, instead of stopping at the first.
+	// Their errors are returned together once all entries have been tried.
+	KeepGoing bool
+
+	// Journal, if set, records every file written, and files it already
+	// records are skipped if their output file exists, which resumes an
+	// interrupted extraction. Only extraction to disk is journaled.
+	Journal *Journal
+}
+
+// ExtractMatching extracts every entry whose name matches pattern into
+// destDir. A pattern is either a name, in which * matches any run of
+// characters within one path element and ** any run across elements (so
+// "docs/*.txt" does not match "docs/old/a.txt" but "docs/**.txt" does), or
+// a directory name ending in /, such as "docs/", which selects the whole
+// subtree. Names that would end up outside destDir ("Zip Slip", e.g.
+// "../../etc/passwd" or absolute paths) are refused. Files keep their stored permissions and modification times, and so
+// do directory entries when RecreateStructure is set. It fails with an error
+// wrapping ErrNotFound if nothing matches.
+func (rzf *RemoteZipFile) ExtractMatching(pattern, destDir string, opts ExtractOptions) error {
+	e := rzf.newExtractor(destDir, opts)
+	if err := e.extract(pattern); err != nil {
+		return err
+	}
+	return errors.Join(e.failed...)
+}
+
+// extractor holds the state of extracting one or more patterns with the same
+// options
+type extractor struct {
+	rzf     *RemoteZipFile
+	destDir string
+	opts    ExtractOptions
+	files   []*zip.File
+	fs      WriteFS
+
+	// stdout, when set, receives the contents of every matching file instead
+	// of writing them to disk
+	stdout io.Writer
+
+	// extracted is shared across patterns so that an entry matched by
+	// several of them is only extracted once
+	extracted map[*zip.File]bool
+
+	// claimed maps the output paths of flattened entries to the names of
+	// the entries written there, for OnCollision
+	claimed map[string]string
+
+	// written, upToDate and resumed count the files written and those
+	// skipped by NewerOnly and as recorded in the Journal
+	written, upToDate, resumed int
+
+	// failed collects the errors of entries skipped under KeepGoing
+	failed []error
+
+	// report, when set, is told what became of each selected entry, for the
+	// CLI's --ndjson output
+	report func(extractEvent)
+}
+
+// extractEvent describes what became of one selected entry
+type extractEvent struct {
+	name   string
+	action string // "extracted", "skipped" or "failed"
+	reason string // why the entry was skipped
+	path   string // where the entry was written, if renamed
+	bytes  int64
+	err    error
+}
+
+// emit passes an event to report, if set
+func (e *extractor) emit(ev extractEvent) {
+	if e.report != nil {
+		e.report(ev)
+	}
+}
+
+func (rzf *RemoteZipFile) newExtractor(destDir string, opts ExtractOptions) *extractor {
+	fsys := opts.FS
+	if fsys == nil {
+		fsys = OSFS{}
+	}
+	return &extractor{
+		rzf:       rzf,
+		destDir:   destDir,
+		opts:      opts,
+		files:     rzf.SortedFiles(opts.Order, opts.DirsFirst),
+		fs:        fsys,
+		extracted: map[*zip.File]bool{},
+		claimed:   map[string]string{},
+	}
+}
+
+// relativePath returns where an entry named name is written, relative to the
+// destination, or false if it should be skipped because StripComponents
+// leaves nothing of it
+func (e *extractor) relativePath(name string) (string, bool) {
+	if !e.opts.RecreateStructure {
+		return filepath.Base(filepath.FromSlash(name)), true
+	}
+
+	for i := 0; i < e.opts.StripComponents; i++ {
+		_, rest, ok := strings.Cut(name, "/")
+		if !ok || rest == "" {
+			return "", false
+		}
+		name = rest
+	}
+	return filepath.FromSlash(name), true
+}
+
+func (e *extractor) extract(pattern string) error {
+	rzf := e.rzf
+	matched := false
+	dirs := map[string]*zip.File{}
+
+	for _, f := range e.files {
+		// Normalize the file name from the ZIP (always uses forward slashes)
+		name := rzf.DisplayName(f)
+		normalizedName := filepath.FromSlash(name)
+
+		// Simple pattern matching (supports * wildcard)
+		if !(matchPattern(pattern, name) || matchPattern(pattern, normalizedName)) || !selected(name, nil, e.opts.Excludes) {
+			continue
+		}
+		if !e.opts.sizeSelected(f) {
+			continue
+		}
+		if e.opts.ContentType != "" {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			ok, err := rzf.hasContentType(f, e.opts.ContentType)
+			if err != nil {
+				matched = true
+				err = fmt.Errorf("failed to detect type of %s: %w", name, err)
+				e.emit(extractEvent{name: name, action: "failed", err: err})
+				if err := e.fail(err); err != nil {
+					return err
+				}
+				continue
+			}
+			if !ok {
+				continue
+			}
+		}
+		matched = true
+
+		err := e.extractEntry(f, name, dirs)
+		if err != nil {
+			e.emit(extractEvent{name: name, action: "failed", err: err})
+		}
+		if err := e.fail(err); err != nil {
+			return err
+		}
+	}
+
+	if !matched {
+		return fmt.Errorf("no files matched pattern %s: %w", pattern, ErrNotFound)
+	}
+
+	// Apply directory metadata last, since extracting files into a directory
+	// updates its modification time
+	for path, f := range dirs {
+		if err := e.fs.Chmod(path, dirPerm(f)); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %w", path, err)
+		}
+		mtime, atime := fileTimes(f)
+		if err := e.fs.Chtimes(path, atime, mtime); err != nil {
+			return fmt.Errorf("failed to set times of %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// extractEntry writes f, a selected entry named name, unless it was already
+// extracted or is to be skipped. Directories created for directory entries
+// are added to dirs.
+func (e *extractor) extractEntry(f *zip.File, name string, dirs map[string]*zip.File) error {
+	rzf := e.rzf
+
+	relPath, ok := e.relativePath(name)
+	if !ok {
+		e.emit(extractEvent{name: name, action: "skipped", reason: "no path components left"})
+		return nil
+	}
+
+	// Refuse names that would land outside the destination directory
+	if e.stdout == nil && !filepath.IsLocal(relPath) {
+		return fmt.Errorf("refusing to extract %s outside the destination directory", name)
+	}
+	outputPath := filepath.Join(e.destDir, relPath)
+
+	if e.extracted[f] {
+		return nil
+	}
+	e.extracted[f] = true
+
+	if f.FileInfo().IsDir() {
+		// Only a recreated tree has a place for empty directories
+		if e.opts.RecreateStructure && e.stdout == nil {
+			if e.opts.NoDirectoryCreation {
+				if err := e.requireDir(outputPath); err != nil {
+					return err
+				}
+			} else if err := e.fs.MkdirAll(outputPath, dirPerm(f)); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", outputPath, err)
+			}
+			dirs[outputPath] = f
+			e.emit(extractEvent{name: name, action: "extracted"})
+		} else {
+			e.emit(extractEvent{name: name, action: "skipped", reason: "directory"})
+		}
+		return nil
+	}
+
+	if e.stdout != nil {
+		n, err := rzf.extractFileTo(f, e.stdout)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+		e.emit(extractEvent{name: name, action: "extracted", bytes: n})
+		return nil
+	}
+
+	var renamed string
+	if !e.opts.RecreateStructure {
+		path, err := e.claim(name, outputPath)
+		if err != nil {
+			return err
+		}
+		if path != outputPath {
+			outputPath, renamed = path, path
+		}
+	}
+
+	// Named pipes and character devices set up by the caller are
+	// streamed into rather than replaced, so policies about existing
+	// files do not apply to them. Other special files are refused.
+	st, err := e.fs.Stat(outputPath)
+	stream := err == nil && isStreamTarget(st.Mode())
+	if err == nil && !stream && !st.Mode().IsRegular() {
+		return fmt.Errorf("refusing to write %s: not a regular file, named pipe or character device", outputPath)
+	}
+	if err == nil && !stream && e.opts.Journal != nil && e.opts.Journal.Done(f) {
+		e.resumed++
+		e.emit(extractEvent{name: name, action: "skipped", reason: "recorded in journal"})
+		return nil
+	}
+	if err == nil && !stream {
+		switch e.opts.Overwrite {
+		case OverwriteNever:
+			e.emit(extractEvent{name: name, action: "skipped", reason: "exists"})
+			return nil
+		case OverwriteError:
+			return fmt.Errorf("failed to write %s: %w", outputPath, os.ErrExist)
+		}
+		if e.opts.NewerOnly && !f.Modified.After(st.ModTime()) {
+			e.upToDate++
+			e.emit(extractEvent{name: name, action: "skipped", reason: "up to date"})
+			return nil
+		}
+	}
+
+	// Create directory structure if needed
+	if dir := filepath.Dir(outputPath); dir != "." && dir != "" {
+		if e.opts.NoDirectoryCreation {
+			if err := e.requireDir(dir); err != nil {
+				return err
+			}
+		} else if err := e.fs.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	if e.opts.Progress != nil {
+		e.opts.Progress(name)
+	}
+
+	n, err := extractToFile(rzf, e.fs, f, outputPath, stream)
+	if err != nil {
+		return err
+	}
+	e.written++
+	if e.opts.Journal != nil {
+		if err := e.opts.Journal.record(f); err != nil {
+			return err
+		}
+	}
+	e.emit(extractEvent{name: name, action: "extracted", bytes: n, path: renamed})
+	return nil
+}
+
+// claim records that the entry name is written to outputPath, applying
+// OnCollision if an earlier entry was. It returns the path to write to.
+func (e *extractor) claim(name, outputPath string) (string, error) {
+	earlier, taken := e.claimed[outputPath]
+	if !taken || e.opts.OnCollision == CollisionOverwrite {
+		e.claimed[outputPath] = name
+		return outputPath, nil
+	}
+	if e.opts.OnCollision == CollisionError {
+		return "", fmt.Errorf("%s and %s would both be written to %s", earlier, name, outputPath)
+	}
+
+	// Keep the extension last, unless the name is nothing but one
+	ext := filepath.Ext(outputPath)
+	if ext == filepath.Base(outputPath) {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(outputPath, ext)
+	for i := 1; ; i++ {
+		path := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if _, taken := e.claimed[path]; !taken {
+			e.claimed[path] = name
+			if e.opts.Renamed != nil {
+				e.opts.Renamed(name, path)
+			}
+			return path, nil
+		}
+	}
+}
+
+// sizeSelected reports whether f passes the MinSize and MaxSize filters
+func (o ExtractOptions) sizeSelected(f *zip.File) bool {
+	if o.MinSize <= 0 && o.MaxSize <= 0 {
+		return true
+	}
+	size := int64(f.UncompressedSize64)
+	return !f.FileInfo().IsDir() &&
+		(o.MinSize <= 0 || size >= o.MinSize) &&
+		(o.MaxSize <= 0 || size <= o.MaxSize)
+}
+
+// requireDir checks that dir exists, for NoDirectoryCreation
+func (e *extractor) requireDir(dir string) error {
+	st, err := e.fs.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s does not exist and directory creation is disabled: %w", dir, err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// fail returns err, or under KeepGoing records it and returns nil so that
+// extraction continues with the next entry
+func (e *extractor) fail(err error) error {
+	if err == nil || !e.opts.KeepGoing {
+		return err
+	}
+	e.failed = append(e.failed, err)
+	return nil
+}
+
+// extractToFile streams f into a file at outputPath in fsys, giving it f's
+// permissions (subject to the umask) and modification and access times. It
+// returns the number of bytes written. The data goes to a temporary file
+// next to outputPath that is synced, given its times and then renamed into
+// place, so outputPath never holds a partial file, even after a crash; the
+// temporary file is removed if extraction fails. With stream, outputPath is
+// an existing named pipe or device that is only opened and written.
+func extractToFile(rzf *RemoteZipFile, fsys WriteFS, f *zip.File, outputPath string, stream bool) (int64, error) {
+	if stream {
+		out, err := fsys.OpenFile(outputPath, os.O_WRONLY, 0)
+		if err != nil {
+			return 0, fmt.Errorf("failed to write %s: %w", outputPath, err)
+		}
+		n, err := rzf.extractFileTo(f, out)
+		if err != nil {
+			out.Close()
+			return 0, fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+		if err := out.Close(); err != nil {
+			return 0, fmt.Errorf("failed to write %s: %w", outputPath, err)
+		}
+		return n, nil
+	}
+
+	tmpPath, out, err := createTemp(fsys, outputPath, filePerm(f))
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	n, err := writeTemp(rzf, fsys, f, tmpPath, out)
+	if err == nil {
+		err = fsys.Rename(tmpPath, outputPath)
+	}
+	if err != nil {
+		fsys.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	return n, nil
+}
+
+// writeTemp extracts f into out, the temporary file at tmpPath, and closes
+// it, ready to be renamed into place
+func writeTemp(rzf *RemoteZipFile, fsys WriteFS, f *zip.File, tmpPath string, out io.WriteCloser) (int64, error) {
+	n, err := rzf.extractFileTo(f, out)
+	if err != nil {
+		out.Close()
+		return 0, fmt.Errorf("failed to extract %s: %w", f.Name, err)
+	}
+
+	// Make sure the data is on disk before the rename publishes it
+	if s, ok := out.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			out.Close()
+			return 0, err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+
+	if !f.Modified.IsZero() {
+		mtime, atime := fileTimes(f)
+		if err := fsys.Chtimes(tmpPath, atime, mtime); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// createTemp creates a new file with a random name in the directory of
+// path, for extractToFile
+func createTemp(fsys WriteFS, path string, perm fs.FileMode) (string, io.WriteCloser, error) {
+	dir, base := filepath.Split(path)
+	for {
+		tmpPath := filepath.Join(dir, "."+base+".tmp"+strconv.FormatUint(rand.Uint64(), 36))
+		out, err := fsys.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		return tmpPath, out, err
+	}
+}
+
+// isStreamTarget reports whether mode is that of a named pipe or character
+// device, which extraction writes to in place
+func isStreamTarget(mode os.FileMode) bool {
+	return mode&os.ModeNamedPipe != 0 || mode&os.ModeCharDevice != 0
+}
+
+// filePerm returns the permissions stored for a file entry, falling back to
+// 0644 for archives that do not record any
+func filePerm(f *zip.File) os.FileMode {
+	if perm := f.Mode().Perm(); perm != 0 {
+		return perm
+	}
+	return 0644
+}
+
+// dirPerm returns the permissions stored for a directory entry, falling back
+// to 0755 for archives that do not record any
+func dirPerm(f *zip.File) os.FileMode {
+	if perm := f.Mode().Perm(); perm != 0 {
+		return perm
+	}
+	return 0755
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unzip-http-go/internal/ziptest"
+)
+
+func TestExtractDirectoryEntries(t *testing.T) {
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "top/"},
+		testFile{name: "top/empty/"},
+		testFile{name: "top/a.txt", body: "a"},
+	))
+	rzf := openTest(t, srv.URL)
+
+	dest := t.TempDir()
+	if err := rzf.ExtractMatching("**", dest, ExtractOptions{RecreateStructure: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"top", "top/empty"} {
+		info, err := os.Stat(filepath.Join(dest, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() || info.Mode().Perm() != 0750 || !info.ModTime().Equal(testModified) {
+			t.Errorf("%s: mode %v, modified %v; want a directory with mode 0750 modified %v",
+				dir, info.Mode(), info.ModTime(), testModified)
+		}
+	}
+
+	// Without RecreateStructure, directory entries are skipped
+	flat := t.TempDir()
+	if err := rzf.ExtractMatching("**", flat, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(flat)
+	if len(entries) != 1 || entries[0].Name() != "a.txt" {
+		t.Errorf("flat extraction wrote %v, want only a.txt", entries)
+	}
+}
+
+func TestExtractRestoresExtraFieldTimes(t *testing.T) {
+	// Times a DOS timestamp cannot hold: odd seconds, and for NTFS 100ns
+	// precision. The DOS fields are left zero.
+	unixTime := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	ntfsTime := time.Date(2021, 5, 6, 7, 8, 9, 123456700, time.UTC)
+	accessed := time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, extra := range map[string][]byte{
+		"dir/unix.txt": ziptest.ExtendedTimestamp(unixTime, accessed, time.Time{}),
+		"dir/ntfs.txt": ziptest.NTFSTimes(ntfsTime, accessed, time.Time{}),
+	} {
+		out, err := w.CreateHeader(&zip.FileHeader{Name: name, Extra: extra})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write([]byte(name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, buf.Bytes())
+	rzf := openTest(t, srv.URL)
+
+	dest := t.TempDir()
+	if err := rzf.ExtractMatching("dir/", dest, ExtractOptions{RecreateStructure: true}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]time.Time{"dir/unix.txt": unixTime, "dir/ntfs.txt": ntfsTime} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(want) {
+			t.Errorf("%s modified %v, want %v", name, info.ModTime().UTC(), want)
+		}
+		times, err := rzf.Times(name)
+		if err != nil || !times.Modified.Equal(want) || !times.Accessed.Equal(accessed) {
+			t.Errorf("Times(%q) = %+v, %v", name, times, err)
+		}
+	}
+}
+
+func TestExtractToWriteFS(t *testing.T) {
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "docs/"},
+		testFile{name: "docs/a.txt", body: "stored"},
+		testFile{name: "docs/sub/b.txt", body: strings.Repeat("deflated ", 100), method: zip.Deflate},
+	))
+	rzf := openTest(t, srv.URL)
+
+	fsys := newMemFS()
+	dest := filepath.FromSlash("/dest")
+	if err := rzf.ExtractMatching("**", dest, ExtractOptions{RecreateStructure: true, FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary files were renamed into place, leaving nothing else
+	want := []string{"/", "/dest", "/dest/docs", "/dest/docs/a.txt", "/dest/docs/sub", "/dest/docs/sub/b.txt"}
+	for i := range want {
+		want[i] = filepath.FromSlash(want[i])
+	}
+	if got := fsys.paths(); !slices.Equal(got, want) {
+		t.Fatalf("paths = %q, want %q", got, want)
+	}
+	// Files get the mode archive/zip records by default, with no umask
+	for name, body := range map[string]string{"a.txt": "stored", "sub/b.txt": strings.Repeat("deflated ", 100)} {
+		f := fsys.files[filepath.Join(dest, "docs", filepath.FromSlash(name))]
+		if string(f.data) != body || f.mode != 0666 || !f.modTime.Equal(testModified) {
+			t.Errorf("%s: %d bytes, mode %v, modified %v", name, len(f.data), f.mode, f.modTime)
+		}
+	}
+	// The directory entry's mode and time are applied with Chmod and Chtimes
+	if dir := fsys.files[filepath.Join(dest, "docs")]; dir.mode != fs.ModeDir|0750 || !dir.modTime.Equal(testModified) {
+		t.Errorf("docs: mode %v, modified %v", dir.mode, dir.modTime)
+	}
+}
+
+func TestExtractCollisions(t *testing.T) {
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "a/config.json", body: "first"},
+		testFile{name: "b/config.json", body: "second"},
+	))
+	rzf := openTest(t, srv.URL)
+	dest := filepath.FromSlash("/dest")
+	first, renamed := filepath.Join(dest, "config.json"), filepath.Join(dest, "config (1).json")
+
+	for _, tc := range []struct {
+		policy  CollisionPolicy
+		want    map[string]string
+		wantErr bool
+	}{
+		{CollisionRename, map[string]string{first: "first", renamed: "second"}, false},
+		{CollisionError, map[string]string{first: "first"}, true},
+		{CollisionOverwrite, map[string]string{first: "second"}, false},
+	} {
+		fsys := newMemFS()
+		fsys.MkdirAll(dest, 0755)
+		var renames []string
+		err := rzf.ExtractMatching("**", dest, ExtractOptions{
+			OnCollision: tc.policy,
+			Renamed:     func(name, path string) { renames = append(renames, name+" -> "+path) },
+			FS:          fsys,
+		})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("policy %d: got error %v, want one: %v", tc.policy, err, tc.wantErr)
+		}
+		got := map[string]string{}
+		for path, f := range fsys.files {
+			if !f.mode.IsDir() {
+				got[path] = string(f.data)
+			}
+		}
+		if !maps.Equal(got, tc.want) {
+			t.Errorf("policy %d: wrote %q, want %q", tc.policy, got, tc.want)
+		}
+		wantRenames := []string(nil)
+		if tc.policy == CollisionRename {
+			wantRenames = []string{"b/config.json -> " + renamed}
+		}
+		if !slices.Equal(renames, wantRenames) {
+			t.Errorf("policy %d: Renamed calls %q, want %q", tc.policy, renames, wantRenames)
+		}
+	}
+
+	// The command line flag selects the policy
+	dir := t.TempDir()
+	if _, stderr, code := runMain(t, dir, "-q", "--on-collision", "rename", srv.URL, "**"); code != 0 {
+		t.Fatalf("--on-collision rename: exit code %d: %s", code, stderr)
+	}
+	if got := walkFiles(t, dir); !slices.Equal(got, []string{"config (1).json", "config.json"}) {
+		t.Errorf("--on-collision rename wrote %q", got)
+	}
+}
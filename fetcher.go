@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Fetcher supplies the bytes of an archive, separating how they are fetched
+// from how the archive is read: HTTP range requests by default, or anything
+// else through NewFromFetcher (an object store SDK, a mock in tests).
+// Its methods may be called concurrently.
+type Fetcher interface {
+	// FetchRange returns the bytes in [start, end), which must be exactly
+	// end-start of them
+	FetchRange(ctx context.Context, start, end int64) ([]byte, error)
+
+	// Size returns the size of the archive
+	Size(ctx context.Context) (int64, error)
+}
+
+// httpFetcher is the default Fetcher, making range requests to rzf.URL with
+// its client, retries and rate limits. Size also records the content type
+// and validators the server reports, for ContentType and Changed.
+type httpFetcher struct {
+	rzf *RemoteZipFile
+}
+
+func (f httpFetcher) FetchRange(ctx context.Context, start, end int64) ([]byte, error) {
+	return f.rzf.fetchRangeRetry(ctx, start, end)
+}
+
+func (f httpFetcher) Size(ctx context.Context) (int64, error) {
+	return f.rzf.detectSize(ctx)
+}
+
+// NewFromFetcher reads an archive through f instead of HTTP. The chunk and
+// content caches, SmallFileThreshold and OpenMany apply as they do to URLs;
+// options specific to HTTP (the client, headers, retries, rate limits and
+// MultiRange) are ignored, and f is responsible for any retrying. Stats
+// count requests and bytes of HTTP fetches only.
+func NewFromFetcher(f Fetcher, options ...Option) (*RemoteZipFile, error) {
+	opts := buildOptions(options)
+	rzf := &RemoteZipFile{
+		opts:    opts,
+		fetcher: f,
+		stats:   new(stats),
+	}
+	if opts.ChunkSize > 0 {
+		rzf.chunks = newChunkCache(opts.ChunkCacheSize)
+	}
+	if opts.ContentCacheSize > 0 {
+		rzf.contents = newContentCache(opts.ContentCacheSize)
+	}
+
+	if err := rzf.loadSize(context.Background()); err != nil {
+		return nil, err
+	}
+	rzf.bufferSmallArchive(context.Background())
+
+	if !opts.DeferIndex {
+		if err := rzf.LoadIndexContext(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return rzf, nil
+}
+
+// loadSize sets the archive size from the fetcher
+func (rzf *RemoteZipFile) loadSize(ctx context.Context) error {
+	size, err := rzf.fetcher.Size(ctx)
+	if err != nil {
+		return err
+	}
+	if size <= 0 {
+		return fmt.Errorf("could not determine file size")
+	}
+	rzf.size = size
+	return nil
+}
+
+// fetch gets [start, end) from the fetcher, rejecting a short or long result
+// that would shift every offset after it
+func (rzf *RemoteZipFile) fetch(ctx context.Context, start, end int64) ([]byte, error) {
+	data, err := rzf.fetcher.FetchRange(ctx, start, end)
+	if err == nil && int64(len(data)) != end-start {
+		err = fmt.Errorf("fetcher returned %d bytes for range %d-%d", len(data), start, end-1)
+	}
+	return data, err
+}
+
+// overHTTP reports whether the archive is fetched with the default HTTP
+// fetcher, as opposed to a local ReaderAt or a custom Fetcher
+func (rzf *RemoteZipFile) overHTTP() bool {
+	_, ok := rzf.fetcher.(httpFetcher)
+	return ok
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// fileReader is the reader returned by Open. Besides io.ReadCloser it
+// implements io.Seeker, with a cost that depends on the compression method:
+//
+//   - Stored entries seek by offset math over the archive, so any seek is a
+//     single range request away. CRC verification stops after the first seek
+//     since the checksum covers the whole entry.
+//   - Compressed and encrypted entries seek forward by decompressing and
+//     discarding bytes. Seeking backward reopens the entry and decompresses
+//     from the start.
+//
+// Callers can feature-detect seeking with a type assertion to io.Seeker.
+type fileReader struct {
+	rzf *RemoteZipFile
+	f   *zip.File
+	rc  io.ReadCloser
+	pos int64
+
+	// pastEnd is set while a stored entry is seeked beyond its end, where
+	// reads find nothing left rather than a short entry
+	pastEnd bool
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.pastEnd {
+		return 0, io.EOF
+	}
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	if limit := r.rzf.opts.MaxDecompressedSize; limit > 0 && r.pos > limit {
+		return n, fmt.Errorf("%w: %s decompresses to more than %d bytes", ErrTooLarge, r.f.Name, limit)
+	}
+	if limit := r.rzf.ratioLimit(r.f); limit >= 0 && r.pos > limit {
+		return n, fmt.Errorf("%w: %s decompresses beyond a ratio of %g", ErrTooLarge, r.f.Name, r.rzf.opts.MaxCompressionRatio)
+	}
+
+	// Catch silent truncation (or overrun) that slips past the CRC check,
+	// e.g. after seeking, where the checksum no longer applies
+	if err == io.EOF && r.pos != int64(r.f.UncompressedSize64) {
+		return n, fmt.Errorf("%w: %s produced %d bytes, expected %d", ErrUnexpectedSize, r.f.Name, r.pos, r.f.UncompressedSize64)
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker. io.SeekEnd is relative to the entry's
+// uncompressed size.
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.pos + offset
+	case io.SeekEnd:
+		target = int64(r.f.UncompressedSize64) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+	if target == r.pos {
+		return r.pos, nil
+	}
+
+	if r.f.Method == zip.Store && r.f.Flags&0x1 == 0 {
+		return r.seekStored(target)
+	}
+	return r.seekCompressed(target)
+}
+
+// seekStored repositions a stored entry by reading straight from the archive
+func (r *fileReader) seekStored(target int64) (int64, error) {
+	dataOffset, err := r.f.DataOffset()
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(r.f.UncompressedSize64)
+	section := io.NewSectionReader(&remoteReaderAt{rzf: r.rzf}, dataOffset, size)
+	if _, err := section.Seek(target, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	r.rc.Close()
+	r.rc = io.NopCloser(section)
+	r.pos = target
+	r.pastEnd = target > size
+	return r.pos, nil
+}
+
+// seekCompressed repositions a compressed entry by discarding output,
+// reopening the entry first when seeking backward
+func (r *fileReader) seekCompressed(target int64) (int64, error) {
+	if target < r.pos {
+		rc, err := r.reopen()
+		if err != nil {
+			return 0, err
+		}
+		r.rc.Close()
+		r.rc = rc
+		r.pos = 0
+	}
+
+	n, err := io.CopyN(io.Discard, r.rc, target-r.pos)
+	r.pos += n
+	if err == io.EOF {
+		return r.pos, fmt.Errorf("seek past end of %s", r.f.Name)
+	}
+	return r.pos, err
+}
+
+// reopen opens the entry again from its start
+func (r *fileReader) reopen() (io.ReadCloser, error) {
+	if r.f.Flags&0x1 != 0 {
+		return r.rzf.openEncrypted(r.f)
+	}
+	return r.f.Open()
+}
+
+func (r *fileReader) Close() error {
+	return r.rc.Close()
+}
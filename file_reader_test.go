@@ -0,0 +1,68 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestTruncatedEntryFails(t *testing.T) {
+	body := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(body)
+	srv := newTestServer(t, buildZip(t, testFile{name: "a.bin", body: string(body)}))
+	srv.ShortBody = 5000
+
+	// The tail and the central directory fit in one short body each, the
+	// entry does not
+	rzf := openTest(t, srv.URL, WithRetry(-1), WithEOCDSearchSize(22))
+	got, err := rzf.Extract("a.bin")
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Extract = %d bytes, %v; want io.ErrUnexpectedEOF", len(got), err)
+	}
+}
+
+func TestDeclaredSizeMismatch(t *testing.T) {
+	// archive/zip checks the size of the entries it decompresses, but not
+	// of decrypted ones, which only fileReader's count catches
+	data := encryptedZip(t, "a.txt", "secret", zip.Deflate, "hunter2")
+	dir := bytes.LastIndex(data, []byte("PK\x01\x02"))
+	binary.LittleEndian.PutUint32(data[dir+24:], 10)
+	srv := newTestServer(t, data)
+
+	rc, err := openTest(t, srv.URL, WithPassword("hunter2")).Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); !errors.Is(err, ErrUnexpectedSize) {
+		t.Errorf("got %v, want ErrUnexpectedSize", err)
+	}
+}
+
+func TestSeekPastEndOfStoredEntry(t *testing.T) {
+	srv := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: "hello"}))
+	rc, err := openTest(t, srv.URL).Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	seeker := rc.(io.Seeker)
+
+	if _, err := seeker.Seek(10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rc.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+		t.Fatalf("Read past the end = %d, %v; want 0, io.EOF", n, err)
+	}
+
+	if _, err := seeker.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(rc); string(got) != "ello" || err != nil {
+		t.Errorf("ReadAll after seeking back = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// FS returns the archive as an fs.FS, for use with fs.WalkDir, http.FS and
+// the like. Directories, including those implied by file paths, are served
+// by archive/zip's own fs.FS; files are served lazily from the server.
+// Without a loaded central directory and in LowMemory mode, only files can
+// be opened.
+//
+// Opened files implement io.Seeker and io.ReaderAt besides fs.File, so
+// http.ServeContent answers Range requests from them, fetching only the
+// archive bytes behind each client range. How well that works depends on
+// the compression method:
+//
+//   - Stored entries read from any offset with a range request for just the
+//     bytes asked for. http.ServeContent copies in 32KB reads, each of them
+//     a request; Options.ChunkSize coalesces them.
+//   - Compressed entries can only be streamed: reading from an offset
+//     decompresses and discards everything before it, and reading behind
+//     the previous position starts again from the beginning of the entry.
+//
+// Seeking itself never downloads anything, so finding the size with
+// Seek(0, io.SeekEnd) is free; the cost is paid by the next Read.
+func (rzf *RemoteZipFile) FS() fs.FS {
+	return remoteFS{rzf}
+}
+
+type remoteFS struct {
+	rzf *RemoteZipFile
+}
+
+func (fsys remoteFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := fsys.rzf.findFile(name)
+	if reader := fsys.rzf.Reader(); (err != nil || f.FileInfo().IsDir()) && reader != nil {
+		return reader.Open(name)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	r, err := fsys.rzf.openFile(f)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{r: r, info: f.FileInfo()}, nil
+}
+
+// fsFile is the fs.File of a file opened through FS. Seek only records the
+// position, which Read moves its fileReader to, so that a seek followed by
+// another seek costs nothing. ReadAt uses a fileReader of its own so as not
+// to disturb the position of Read.
+type fsFile struct {
+	r    *fileReader
+	info fs.FileInfo
+	pos  int64
+
+	// mu guards at, which ReadAt opens on first use
+	mu sync.Mutex
+	at *fileReader
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.pos >= f.info.Size() {
+		return 0, io.EOF
+	}
+	if f.pos != f.r.pos {
+		if _, err := f.r.Seek(f.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.r.Read(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker. io.SeekEnd is relative to the file's
+// uncompressed size.
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = f.pos + offset
+	case io.SeekEnd:
+		target = f.info.Size() + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = target
+	return target, nil
+}
+
+// ReadAt implements io.ReaderAt. It is safe for concurrent use, though
+// calls are served one at a time.
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.at == nil {
+		at, err := f.r.rzf.openFile(f.r.f)
+		if err != nil {
+			return 0, err
+		}
+		f.at = at
+	}
+	if _, err := f.at.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(f.at, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *fsFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.at != nil {
+		f.at.Close()
+	}
+	return f.r.Close()
+}
@@ -1,3 +1,10 @@
 module github.com/unzip-http-go
 
-go 1.21
+go 1.25.0
+
+require (
+	github.com/klauspost/compress v1.20.1
+	golang.org/x/term v0.45.0
+)
+
+require golang.org/x/sys v0.47.0 // indirect
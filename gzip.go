@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gunzipArchive replaces a gzip-compressed archive with its decompressed
+// contents held in memory, for Options.GunzipFallback. Only the first gzip
+// member is read. The compressed download and the result are each limited
+// to MaxBufferedSize.
+func (rzf *RemoteZipFile) gunzipArchive(ctx context.Context) error {
+	limit := rzf.opts.MaxBufferedSize
+	if limit <= 0 {
+		limit = defaultMaxBufferedSize
+	}
+	if rzf.size > limit {
+		return fmt.Errorf("%w: archive of %d bytes exceeds the %d byte buffer limit", ErrGzipped, rzf.size, limit)
+	}
+
+	data, err := rzf.getRangeContext(ctx, 0, rzf.size)
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decompress gzip-compressed archive: %w", err)
+	}
+	zr.Multistream(false)
+	out, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return fmt.Errorf("failed to decompress gzip-compressed archive: %w", err)
+	}
+	if int64(len(out)) > limit {
+		return fmt.Errorf("decompressed archive exceeds the %d byte buffer limit", limit)
+	}
+
+	// Reopen downloads a remote archive again; one read from a ReaderAt
+	// is decompressed again from there
+	rzf.gzipSize = rzf.size
+	rzf.local = bytes.NewReader(out)
+	rzf.buffered = rzf.fetcher != nil
+	rzf.size = int64(len(out))
+	if rzf.chunks != nil {
+		rzf.chunks.reset()
+	}
+	return nil
+}
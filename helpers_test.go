@@ -0,0 +1,261 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/unzip-http-go/internal/ziptest"
+)
+
+// testModified is the modification time buildZip gives every entry
+var testModified = time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+
+// testFile is an entry for buildZip. Names ending in a slash are
+// directories.
+type testFile struct {
+	name   string
+	body   string
+	method uint16
+}
+
+// buildZip returns an archive holding files, in order
+func buildZip(t *testing.T, files ...testFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fh := &zip.FileHeader{Name: f.name, Method: f.method, Modified: testModified}
+		if strings.HasSuffix(f.name, "/") {
+			fh.SetMode(fs.ModeDir | 0750)
+		}
+		out, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := out.Write([]byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestServer serves data until the test ends. Its misbehaviour knobs
+// can be set before the first request.
+func newTestServer(t *testing.T, data []byte) *ziptest.Server {
+	srv := ziptest.NewServer(data)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// openTest opens the archive at url with opts, closing it when the test
+// ends. Small archives are not buffered, so every read is a range request.
+func openTest(t *testing.T, url string, opts ...Option) *RemoteZipFile {
+	t.Helper()
+	rzf, err := NewRemoteZipFile(url, append([]Option{WithSmallFileThreshold(-1)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rzf.Close)
+	return rzf
+}
+
+// mainArgsEnv passes the arguments of runMain to the test binary, which
+// then runs main instead of the tests
+const mainArgsEnv = "UNZIP_HTTP_TEST_MAIN_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = append([]string{"unzip-http"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the command line tool with args in dir, returning its
+// stdout, stderr and exit code
+func runMain(t *testing.T, dir string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// memFS is an in-memory WriteFS, so that extraction can be tested without a
+// temporary directory. It keeps each file's contents, mode and
+// modification time, keyed by cleaned path.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{}}
+}
+
+func (m *memFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if f, ok := m.files[dir]; ok {
+			if !f.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+		} else {
+			m.files[dir] = &memFile{name: filepath.Base(dir), mode: fs.ModeDir | perm}
+		}
+		if filepath.Dir(dir) == dir {
+			return nil
+		}
+	}
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if parent, ok := m.files[filepath.Dir(name)]; !ok || !parent.mode.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f, ok := m.files[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case ok && f.mode.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case ok && flag&os.O_TRUNC != 0:
+		f.data = nil
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		f = &memFile{name: filepath.Base(name), mode: perm}
+		m.files[name] = f
+	}
+	return &memWriter{fs: m, f: f}, nil
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	info := *f
+	return &info, nil
+}
+
+func (m *memFS) Chmod(name string, mode fs.FileMode) error {
+	return m.update(name, func(f *memFile) { f.mode = f.mode.Type() | mode.Perm() })
+}
+
+func (m *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	return m.update(name, func(f *memFile) { f.modTime = mtime })
+}
+
+// update calls fn with the file name under the lock
+func (m *memFS) update(name string, fn func(f *memFile)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return &fs.PathError{Op: "update", Path: name, Err: fs.ErrNotExist}
+	}
+	fn(f)
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	f, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	f.name = filepath.Base(newpath)
+	m.files[newpath] = f
+	return nil
+}
+
+// paths returns the paths of all files and directories, in lexical order
+func (m *memFS) paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.files))
+}
+
+// memWriter appends to a memFile
+type memWriter struct {
+	fs *memFS
+	f  *memFile
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	w.f.data = append(w.f.data, p...)
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error {
+	return nil
+}
+
+// fs.FileInfo of a memFile, for Stat
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFile) Sys() any           { return nil }
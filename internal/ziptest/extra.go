@@ -0,0 +1,48 @@
+package ziptest
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// ExtendedTimestamp returns an Extended Timestamp (0x5455) extra field
+// holding the given times, for use as zip.FileHeader.Extra. Zero times are
+// left out. Like Info-ZIP, pass only the modification time for the central
+// directory's copy of the field.
+func ExtendedTimestamp(modified, accessed, created time.Time) []byte {
+	data := []byte{0}
+	for bit, t := range []time.Time{modified, accessed, created} {
+		if t.IsZero() {
+			continue
+		}
+		data[0] |= 1 << bit
+		data = binary.LittleEndian.AppendUint32(data, uint32(t.Unix()))
+	}
+	return extraField(0x5455, data)
+}
+
+// NTFSTimes returns an NTFS (0x000a) extra field holding the given times
+// with 100ns precision, for use as zip.FileHeader.Extra
+func NTFSTimes(modified, accessed, created time.Time) []byte {
+	data := make([]byte, 4, 32)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 24)
+	for _, t := range []time.Time{modified, accessed, created} {
+		data = binary.LittleEndian.AppendUint64(data, fileTime(t))
+	}
+	return extraField(0x000a, data)
+}
+
+// fileTime converts t to a Windows FILETIME, 100ns ticks since 1601
+func fileTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+func extraField(id uint16, data []byte) []byte {
+	field := binary.LittleEndian.AppendUint16(nil, id)
+	field = binary.LittleEndian.AppendUint16(field, uint16(len(data)))
+	return append(field, data...)
+}
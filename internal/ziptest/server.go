@@ -0,0 +1,176 @@
+// Package ziptest serves in-memory archives over HTTP for tests and
+// benchmarks of the range-request code paths.
+package ziptest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Server serves Data with full single-range support: HEAD advertises
+// Accept-Ranges and Content-Length, ranged GETs get a 206 with Content-Range,
+// and unsatisfiable ranges get a 416. The misbehaviour knobs must be set
+// before the server receives requests.
+type Server struct {
+	*httptest.Server
+
+	// Data is the archive being served
+	Data []byte
+
+	// Latency is added before every response is written
+	Latency time.Duration
+
+	// IgnoreRange makes ranged GETs return 200 with the whole body
+	IgnoreRange bool
+
+	// ShortBody, if positive, cuts range responses off after this many bytes
+	// and closes the connection, while still promising the full length
+	ShortBody int
+
+	// RejectHead makes HEAD requests fail with 405 Method Not Allowed
+	RejectHead bool
+
+	// RangeShift moves the window of range responses this many bytes from
+	// the one requested, within the data, with a Content-Range that says
+	// so, as a misbehaving proxy might
+	RangeShift int64
+
+	// ContentRange, if set, is sent as the Content-Range header of range
+	// responses in place of the correct one, e.g. a malformed value
+	ContentRange string
+
+	requests      atomic.Int64
+	rangeRequests atomic.Int64
+}
+
+// NewServer starts a Server for data. Callers must Close it.
+func NewServer(data []byte) *Server {
+	s := &Server{Data: data}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Requests returns the number of requests received so far
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+// RangeRequests returns the number of requests that carried a Range header
+func (s *Server) RangeRequests() int64 {
+	return s.rangeRequests.Load()
+}
+
+// ResetCounters sets the request counters back to zero, e.g. after the
+// archive has been opened and before the operation being measured
+func (s *Server) ResetCounters() {
+	s.requests.Store(0)
+	s.rangeRequests.Store(0)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if s.Latency > 0 {
+		time.Sleep(s.Latency)
+	}
+
+	size := int64(len(s.Data))
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	switch r.Method {
+	case http.MethodHead:
+		if s.RejectHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		return
+	case http.MethodGet:
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	header := r.Header.Get("Range")
+	if header == "" || s.IgnoreRange {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Write(s.Data)
+		return
+	}
+	s.rangeRequests.Add(1)
+
+	start, end, ok := parseRange(header, size)
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if s.RangeShift != 0 {
+		start = min(max(start+s.RangeShift, 0), size-1)
+		end = min(max(end+s.RangeShift, start), size-1)
+	}
+	body := s.Data[start : end+1]
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	if s.ContentRange != "" {
+		w.Header().Set("Content-Range", s.ContentRange)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusPartialContent)
+
+	if s.ShortBody > 0 && s.ShortBody < len(body) {
+		w.Write(body[:s.ShortBody])
+		w.(http.Flusher).Flush()
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+			}
+		}
+		return
+	}
+	w.Write(body)
+}
+
+// parseRange parses a single "bytes=" range against size, returning the
+// inclusive bounds. Multiple ranges are treated as unsatisfiable.
+func parseRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, size > 0
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
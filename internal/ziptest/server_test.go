@@ -0,0 +1,99 @@
+package ziptest
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+// get requests the server's data with the given Range header, if any
+func get(t *testing.T, s *Server, rangeHeader string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestServerRanges(t *testing.T) {
+	s := NewServer([]byte("0123456789"))
+	defer s.Close()
+
+	for _, tc := range []struct {
+		header, body, contentRange string
+		status                     int
+	}{
+		{"bytes=2-4", "234", "bytes 2-4/10", http.StatusPartialContent},
+		{"bytes=7-", "789", "bytes 7-9/10", http.StatusPartialContent},
+		{"bytes=-2", "89", "bytes 8-9/10", http.StatusPartialContent},
+		{"bytes=8-20", "89", "bytes 8-9/10", http.StatusPartialContent},
+		{"bytes=10-12", "", "bytes */10", http.StatusRequestedRangeNotSatisfiable},
+		{"", "0123456789", "", http.StatusOK},
+	} {
+		resp, body := get(t, s, tc.header)
+		if resp.StatusCode != tc.status || string(body) != tc.body || resp.Header.Get("Content-Range") != tc.contentRange {
+			t.Errorf("Range %q: got %d %q with Content-Range %q", tc.header, resp.StatusCode, body, resp.Header.Get("Content-Range"))
+		}
+	}
+	if s.Requests() != 6 || s.RangeRequests() != 5 {
+		t.Errorf("counted %d requests, %d with a range; want 6 and 5", s.Requests(), s.RangeRequests())
+	}
+}
+
+func TestServerMisbehaviour(t *testing.T) {
+	data := []byte("0123456789")
+
+	s := NewServer(data)
+	s.RejectHead = true
+	resp, err := http.Head(s.URL)
+	if err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("RejectHead: HEAD got %v, %v", resp.Status, err)
+	}
+	s.Close()
+
+	s = NewServer(data)
+	s.IgnoreRange = true
+	if resp, body := get(t, s, "bytes=2-4"); resp.StatusCode != http.StatusOK || string(body) != string(data) {
+		t.Errorf("IgnoreRange: got %d %q", resp.StatusCode, body)
+	}
+	s.Close()
+
+	s = NewServer(data)
+	s.RangeShift = 3
+	if resp, body := get(t, s, "bytes=2-4"); string(body) != "567" || resp.Header.Get("Content-Range") != "bytes 5-7/10" {
+		t.Errorf("RangeShift: got %q with Content-Range %q", body, resp.Header.Get("Content-Range"))
+	}
+	s.Close()
+
+	s = NewServer(data)
+	s.ContentRange = "bytes garbage"
+	if resp, body := get(t, s, "bytes=2-4"); string(body) != "234" || resp.Header.Get("Content-Range") != "bytes garbage" {
+		t.Errorf("ContentRange: got %q with Content-Range %q", body, resp.Header.Get("Content-Range"))
+	}
+	s.Close()
+
+	s = NewServer(data)
+	s.ShortBody = 2
+	req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	req.Header.Set("Range", "bytes=2-8")
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Errorf("ShortBody: %v", err)
+	} else {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "23" || err != io.ErrUnexpectedEOF {
+			t.Errorf("ShortBody: got %q, %v; want the first 2 bytes and io.ErrUnexpectedEOF", body, err)
+		}
+	}
+	s.Close()
+}
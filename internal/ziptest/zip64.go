@@ -0,0 +1,125 @@
+package ziptest
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// Sparse is a ZIP64 archive holding one stored entry whose local header
+// starts at an arbitrary offset, such as beyond 4GB, after a run of zeros
+// that is never stored. Sizes and the header offset are recorded only in
+// ZIP64 extended information extra fields (0x0001), with the 32-bit fields
+// set to 0xFFFFFFFF. It implements io.ReaderAt for NewFromReaderAt.
+type Sparse struct {
+	offset int64
+	tail   []byte
+}
+
+// NewSparse builds a Sparse archive with an entry called name holding data,
+// whose local header starts at offset
+func NewSparse(name string, data []byte, offset int64) *Sparse {
+	crc := crc32.ChecksumIEEE(data)
+	size := uint64(len(data))
+	le := binary.LittleEndian
+
+	// Local file header with a ZIP64 extra field for the sizes
+	b := le.AppendUint32(nil, 0x04034b50)
+	b = le.AppendUint16(b, 45) // version needed
+	b = le.AppendUint16(b, 0)  // flags
+	b = le.AppendUint16(b, 0)  // stored
+	b = le.AppendUint32(b, 0)  // DOS time and date
+	b = le.AppendUint32(b, crc)
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = le.AppendUint16(b, uint16(len(name)))
+	b = le.AppendUint16(b, 20)
+	b = append(b, name...)
+	b = le.AppendUint16(b, 0x0001)
+	b = le.AppendUint16(b, 16)
+	b = le.AppendUint64(b, size)
+	b = le.AppendUint64(b, size)
+	b = append(b, data...)
+
+	// Central directory header, adding the header offset to the extra field
+	dirOffset := offset + int64(len(b))
+	dirStart := len(b)
+	b = le.AppendUint32(b, 0x02014b50)
+	b = le.AppendUint16(b, 45) // version made by
+	b = le.AppendUint16(b, 45) // version needed
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint32(b, crc)
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = le.AppendUint16(b, uint16(len(name)))
+	b = le.AppendUint16(b, 28)
+	b = le.AppendUint16(b, 0) // comment length
+	b = le.AppendUint16(b, 0) // disk number
+	b = le.AppendUint16(b, 0) // internal attributes
+	b = le.AppendUint32(b, 0) // external attributes
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = append(b, name...)
+	b = le.AppendUint16(b, 0x0001)
+	b = le.AppendUint16(b, 24)
+	b = le.AppendUint64(b, size)
+	b = le.AppendUint64(b, size)
+	b = le.AppendUint64(b, uint64(offset))
+	dirSize := uint64(len(b) - dirStart)
+
+	// ZIP64 end of central directory record and locator
+	zip64End := offset + int64(len(b))
+	b = le.AppendUint32(b, 0x06064b50)
+	b = le.AppendUint64(b, 44)
+	b = le.AppendUint16(b, 45)
+	b = le.AppendUint16(b, 45)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint64(b, 1)
+	b = le.AppendUint64(b, 1)
+	b = le.AppendUint64(b, dirSize)
+	b = le.AppendUint64(b, uint64(dirOffset))
+
+	b = le.AppendUint32(b, 0x07064b50)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint64(b, uint64(zip64End))
+	b = le.AppendUint32(b, 1)
+
+	// End of central directory record deferring to the ZIP64 one
+	b = le.AppendUint32(b, 0x06054b50)
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint16(b, 0xFFFF)
+	b = le.AppendUint16(b, 0xFFFF)
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = le.AppendUint32(b, 0xFFFFFFFF)
+	b = le.AppendUint16(b, 0)
+
+	return &Sparse{offset: offset, tail: b}
+}
+
+// Size returns the size of the archive
+func (s *Sparse) Size() int64 {
+	return s.offset + int64(len(s.tail))
+}
+
+// ReadAt reads zeros before the entry and the stored bytes after
+func (s *Sparse) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.Size() {
+		return 0, io.EOF
+	}
+	n := 0
+	if off < s.offset {
+		n = int(min(int64(len(p)), s.offset-off))
+		clear(p[:n])
+		off += int64(n)
+	}
+	if off >= s.offset {
+		n += copy(p[n:], s.tail[off-s.offset:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Journal records which entries an extraction has written, so that one
+// interrupted by a crash or a dropped link can be resumed without fetching
+// them again (see ExtractOptions.Journal). It is a text file with a line per
+// entry holding its CRC-32, uncompressed size and quoted name. Each line is
+// appended with a single write and synced once the entry's file is
+// complete, so an interruption leaves at most a partial last line, which is
+// ignored when the journal is read back. Entries are matched on all three
+// fields, so a journal written for an older version of the archive does not
+// skip entries that have changed since.
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[journalEntry]bool
+}
+
+type journalEntry struct {
+	name string
+	crc  uint32
+	size uint64
+}
+
+// OpenJournal opens the journal at path, creating it if it does not exist.
+// With resume, the entries it records count as done; otherwise it is
+// emptied to start over.
+func OpenJournal(path string, resume bool) (*Journal, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j := &Journal{file: file, done: map[journalEntry]bool{}}
+	if resume {
+		if err := j.load(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+		}
+	}
+	return j, nil
+}
+
+// load reads the entries recorded so far, dropping a partial last line so
+// that new entries start on a line of their own
+func (j *Journal) load() error {
+	r := bufio.NewReader(j.file)
+	var complete int64
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			// Whatever follows the last newline was cut off mid-write
+			if line != "" {
+				return j.file.Truncate(complete)
+			}
+			return nil
+		}
+		complete += int64(len(line))
+
+		var entry journalEntry
+		crc, rest, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		size, quoted, _ := strings.Cut(rest, " ")
+		c, err := strconv.ParseUint(crc, 16, 32)
+		if err != nil {
+			return fmt.Errorf("malformed line %q", line)
+		}
+		if entry.size, err = strconv.ParseUint(size, 10, 64); err != nil {
+			return fmt.Errorf("malformed line %q", line)
+		}
+		if entry.name, err = strconv.Unquote(quoted); err != nil {
+			return fmt.Errorf("malformed line %q", line)
+		}
+		entry.crc = uint32(c)
+		j.done[entry] = true
+	}
+}
+
+// Done reports whether the journal records f as written
+func (j *Journal) Done(f *zip.File) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.done[journalEntryOf(f)]
+}
+
+// record appends f to the journal and syncs it
+func (j *Journal) record(f *zip.File) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := journalEntryOf(f)
+	line := fmt.Sprintf("%08x %d %s\n", entry.crc, entry.size, strconv.Quote(entry.name))
+	if _, err := j.file.WriteString(line); err != nil {
+		return fmt.Errorf("failed to update journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to update journal: %w", err)
+	}
+	j.done[entry] = true
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+func journalEntryOf(f *zip.File) journalEntry {
+	return journalEntry{name: f.Name, crc: f.CRC32, size: f.UncompressedSize64}
+}
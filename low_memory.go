@@ -0,0 +1,280 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dirScanBufferSize is the size of the range requests that stream the
+// central directory in LowMemory mode
+const dirScanBufferSize = 64 << 10
+
+// dirHeaderSignature starts every central directory file header
+const dirHeaderSignature = 0x02014b50
+
+// locateDirectory records where the central directory is, reading the ZIP64
+// end record if the EOCD defers to it, without parsing any entries
+func (rzf *RemoteZipFile) locateDirectory(ctx context.Context, endData []byte, eocdPos int) error {
+	eocd := endData[eocdPos:]
+	entries := int64(binary.LittleEndian.Uint16(eocd[10:12]))
+	size := int64(binary.LittleEndian.Uint32(eocd[12:16]))
+	offset := int64(binary.LittleEndian.Uint32(eocd[16:20]))
+
+	if entries == 0xFFFF || size == 0xFFFFFFFF || offset == 0xFFFFFFFF {
+		// The ZIP64 end of central directory locator sits just before the EOCD
+		locatorPos := eocdPos - 20
+		if locatorPos < 0 || binary.LittleEndian.Uint32(endData[locatorPos:]) != 0x07064b50 {
+			return fmt.Errorf("ZIP64 end of central directory locator not found")
+		}
+		recordOffset := int64(binary.LittleEndian.Uint64(endData[locatorPos+8:]))
+		record, err := rzf.getRangeContext(ctx, recordOffset, recordOffset+56)
+		if err != nil {
+			return err
+		}
+		if len(record) < 56 || binary.LittleEndian.Uint32(record) != 0x06064b50 {
+			return fmt.Errorf("invalid ZIP64 end of central directory record")
+		}
+		entries = int64(binary.LittleEndian.Uint64(record[32:40]))
+		size = int64(binary.LittleEndian.Uint64(record[40:48]))
+		offset = int64(binary.LittleEndian.Uint64(record[48:56]))
+	}
+
+	if err := rzf.checkEntryCount(int(entries)); err != nil {
+		return err
+	}
+	rzf.dirOffset = rzf.baseOffset + offset
+	rzf.dirSize = size
+	if rzf.dirOffset < 0 || size < 0 || rzf.dirOffset+size > rzf.size {
+		return fmt.Errorf("central directory at %d (%d bytes) is outside the file", rzf.dirOffset, size)
+	}
+	rzf.entryCount = int(entries)
+	rzf.files = []*zip.File{}
+	return nil
+}
+
+// scanDirectory streams the central directory in LowMemory mode, calling fn
+// with each raw file header (fixed fields, name, extra and comment) and the
+// header's absolute offset, until fn returns false. Only one header is held
+// in memory at a time.
+func (rzf *RemoteZipFile) scanDirectory(fn func(record []byte, offset int64) bool) error {
+	st := rzf.state()
+	r := bufio.NewReaderSize(io.NewSectionReader(&remoteReaderAt{rzf: rzf}, st.dirOffset, st.dirSize), dirScanBufferSize)
+	offset := st.dirOffset
+	var fixed [46]byte
+	for {
+		if _, err := io.ReadFull(r, fixed[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read central directory: %w", err)
+		}
+		if binary.LittleEndian.Uint32(fixed[:4]) != dirHeaderSignature {
+			return fmt.Errorf("invalid central directory header at offset %d", offset)
+		}
+		n := int(binary.LittleEndian.Uint16(fixed[28:30])) +
+			int(binary.LittleEndian.Uint16(fixed[30:32])) +
+			int(binary.LittleEndian.Uint16(fixed[32:34]))
+		record := make([]byte, 46+n)
+		copy(record, fixed[:])
+		if _, err := io.ReadFull(r, record[46:]); err != nil {
+			return fmt.Errorf("failed to read central directory: %w", err)
+		}
+		if !fn(record, offset) {
+			return nil
+		}
+		offset += int64(len(record))
+	}
+}
+
+// ScanNames calls fn with the raw name of each entry, in directory order,
+// until fn returns false. In LowMemory mode the central directory is
+// streamed from the server on every call instead of being held in memory.
+func (rzf *RemoteZipFile) ScanNames(fn func(name string) bool) error {
+	st := rzf.state()
+	if !st.indexed {
+		return errNotIndexed
+	}
+	if !rzf.opts.LowMemory {
+		for _, f := range st.files {
+			if !fn(f.Name) {
+				break
+			}
+		}
+		return nil
+	}
+
+	return rzf.scanDirectory(func(record []byte, _ int64) bool {
+		name := string(record[46 : 46+binary.LittleEndian.Uint16(record[28:30])])
+		return !strings.HasPrefix(name, rzf.opts.Prefix) || fn(name)
+	})
+}
+
+// ScanEntries calls fn with each entry, in directory order, until fn
+// returns false, for directories too large to load up front. In LowMemory
+// mode the central directory is read from the server in 64KB range
+// requests as the scan goes, each header parsed as it arrives and dropped
+// once fn returns, so memory stays flat whatever the directory's size and
+// a scan that stops early, e.g. once a wanted entry is found, costs only
+// the pages read so far instead of a download of the whole directory
+// before the first entry is seen. Outside LowMemory mode the loaded
+// entries are passed. An entry's own Open method reads its data through
+// the same range requests, but like the entries of Reader skips this
+// package's checks, which Open by name applies at the cost of another scan.
+func (rzf *RemoteZipFile) ScanEntries(fn func(f *zip.File) bool) error {
+	st := rzf.state()
+	if !st.indexed {
+		return errNotIndexed
+	}
+	if !rzf.opts.LowMemory {
+		for _, f := range st.files {
+			if !fn(f) {
+				break
+			}
+		}
+		return nil
+	}
+
+	var parseErr error
+	err := rzf.scanDirectory(func(record []byte, offset int64) bool {
+		name := string(record[46 : 46+binary.LittleEndian.Uint16(record[28:30])])
+		if !strings.HasPrefix(name, rzf.opts.Prefix) {
+			return true
+		}
+		f, err := rzf.fileFromRecord(record, offset)
+		if err != nil {
+			parseErr = err
+			return false
+		}
+		return fn(f)
+	})
+	if err != nil {
+		return err
+	}
+	return parseErr
+}
+
+// scanForFile finds the entry with the given raw name in LowMemory mode
+func (rzf *RemoteZipFile) scanForFile(name string) (*zip.File, error) {
+	if !strings.HasPrefix(name, rzf.opts.Prefix) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	var found []byte
+	var foundOffset int64
+	err := rzf.scanDirectory(func(record []byte, offset int64) bool {
+		nameLen := binary.LittleEndian.Uint16(record[28:30])
+		if string(record[46:46+nameLen]) == name {
+			found, foundOffset = record, offset
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return rzf.fileFromRecord(found, foundOffset)
+}
+
+// fileFromRecord turns a single central directory header into a *zip.File
+// that reads from the archive, by parsing a virtual archive made of the real
+// file up to the header followed by just that header and an EOCD record.
+// archive/zip then handles the header's ZIP64 and other extra fields as usual.
+func (rzf *RemoteZipFile) fileFromRecord(record []byte, offset int64) (*zip.File, error) {
+	var tail bytes.Buffer
+	tail.Write(record)
+
+	dirOffset := offset - rzf.state().baseOffset
+	eocd := make([]byte, 22)
+	binary.LittleEndian.PutUint32(eocd[0:], 0x06054b50)
+	if dirOffset < 0xFFFFFFFF {
+		binary.LittleEndian.PutUint16(eocd[8:], 1)
+		binary.LittleEndian.PutUint16(eocd[10:], 1)
+		binary.LittleEndian.PutUint32(eocd[12:], uint32(len(record)))
+		binary.LittleEndian.PutUint32(eocd[16:], uint32(dirOffset))
+	} else {
+		// The directory offset needs a ZIP64 end record and its locator
+		zip64End := offset + int64(len(record))
+		rec := make([]byte, 56)
+		binary.LittleEndian.PutUint32(rec[0:], 0x06064b50)
+		binary.LittleEndian.PutUint64(rec[4:], 44)
+		binary.LittleEndian.PutUint16(rec[12:], 45)
+		binary.LittleEndian.PutUint16(rec[14:], 45)
+		binary.LittleEndian.PutUint64(rec[24:], 1)
+		binary.LittleEndian.PutUint64(rec[32:], 1)
+		binary.LittleEndian.PutUint64(rec[40:], uint64(len(record)))
+		binary.LittleEndian.PutUint64(rec[48:], uint64(dirOffset))
+		tail.Write(rec)
+
+		locator := make([]byte, 20)
+		binary.LittleEndian.PutUint32(locator[0:], 0x07064b50)
+		binary.LittleEndian.PutUint64(locator[8:], uint64(zip64End))
+		binary.LittleEndian.PutUint32(locator[16:], 1)
+		tail.Write(locator)
+
+		binary.LittleEndian.PutUint16(eocd[8:], 0xFFFF)
+		binary.LittleEndian.PutUint16(eocd[10:], 0xFFFF)
+		binary.LittleEndian.PutUint32(eocd[12:], 0xFFFFFFFF)
+		binary.LittleEndian.PutUint32(eocd[16:], 0xFFFFFFFF)
+	}
+	tail.Write(eocd)
+
+	// Parsing only needs the tail: the EOCD search reads the last 1KB, and
+	// finds our record last. Serve zeros before it meanwhile, so that this
+	// costs no requests, and switch to the real file for reading entry data.
+	ra := &splicedReaderAt{head: zeroReaderAt{}, split: offset, tail: tail.Bytes()}
+	zr, err := zip.NewReader(ra, offset+int64(tail.Len()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid central directory header at offset %d: %w", offset, err)
+	}
+	ra.head = &remoteReaderAt{rzf: rzf}
+	rzf.registerDecompressors(zr)
+	return zr.File[0], nil
+}
+
+// zeroReaderAt reads zeros
+type zeroReaderAt struct{}
+
+func (zeroReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// splicedReaderAt reads [0, split) from head and the bytes after it from tail
+type splicedReaderAt struct {
+	head  io.ReaderAt
+	split int64
+	tail  []byte
+}
+
+func (s *splicedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < s.split {
+		m := int(min(int64(len(p)), s.split-off))
+		k, err := s.head.ReadAt(p[:m], off)
+		n += k
+		if err != nil {
+			return n, err
+		}
+		off += int64(k)
+	}
+	if n < len(p) {
+		rel := off - s.split
+		if rel >= int64(len(s.tail)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], s.tail[rel:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
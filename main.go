@@ -1,127 +1,905 @@
 package main
 
 import (
-	"flag"
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 func main() {
-	// Command-line flags
-	listFiles := flag.Bool("l", false, "List files in remote .zip file")
-	recreateStructure := flag.Bool("f", false, "Recreate folder structure from .zip file when extracting")
-	writeStdout := flag.Bool("o", false, "Write files to stdout")
-	flag.Parse()
+	o, args := parseCommandLine(os.Args[1:])
 
-	args := flag.Args()
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "Usage: unzip-http [-l] [-f] [-o] <url> [filenames...]\n")
-		fmt.Fprintf(os.Stderr, "\nExtract individual files from .zip files over http without downloading the entire archive.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: unzip-http [-l] [-t] [-f] [-o] [-p] [-q] [-x pattern] [--from-file manifest] [--decode-names] [--normalize-backslashes] [--gunzip] [--password-stdin] [--strip-components N] [--no-directory-creation] [--select-largest | --select-smallest] [--content-type prefix] [--min-size size] [--max-size size] [--keep-going] [--journal file [--resume]] [--resume-file] [--repack out.zip] [--newer-only] [--on-collision policy] [--sort order] [--dirs-first] [--list-long] [--tree] [--checksum] [--max-connections N] [--chunk-size N] [--estimate] [--stats] [--ndjson] <url> [filenames...]\n")
+		fmt.Fprintf(os.Stderr, "       unzip-http <command> [options] <url> [patterns...]\n")
+		fmt.Fprintf(os.Stderr, "\nExtract individual files from .zip files over http without downloading the entire archive.\n")
+		fmt.Fprintf(os.Stderr, "Use - as the url to read a (fully buffered) archive from stdin.\n")
+		fmt.Fprintf(os.Stderr, "In filenames, * matches within one directory level and ** across levels; dir/ selects a whole subtree.\n\n")
+		fmt.Fprintf(os.Stderr, "Commands, which take only the options that apply to them (see unzip-http <command> -h):\n")
+		for _, cmd := range commands {
+			fmt.Fprintf(os.Stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintf(os.Stderr, "\nWithout a command, the mode is chosen by -l and -t, and all options are accepted.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
-		fmt.Fprintf(os.Stderr, "  -l    List files in remote .zip file (default if no filenames given)\n")
+		fmt.Fprintf(os.Stderr, "  -l    List files in remote .zip file, or only those matching filenames (default if no filenames given)\n")
+		fmt.Fprintf(os.Stderr, "  -t, --test\n")
+		fmt.Fprintf(os.Stderr, "        Decompress the matching files (all if no filenames given) and check their CRC-32\n")
+		fmt.Fprintf(os.Stderr, "        without writing anything, exiting nonzero if any fails\n")
 		fmt.Fprintf(os.Stderr, "  -f    Recreate folder structure from .zip file when extracting\n")
 		fmt.Fprintf(os.Stderr, "  -o    Write files to stdout\n")
+		fmt.Fprintf(os.Stderr, "  -p    Write the one file matching filenames to stdout and nothing else but errors;\n")
+		fmt.Fprintf(os.Stderr, "        fails if they match more than one file\n")
+		fmt.Fprintf(os.Stderr, "  -x pattern\n")
+		fmt.Fprintf(os.Stderr, "        Exclude files matching pattern from listing and extraction (repeatable)\n")
+		fmt.Fprintf(os.Stderr, "  --from-file manifest\n")
+		fmt.Fprintf(os.Stderr, "        Also extract the names or patterns listed one per line in manifest (# starts a comment)\n")
+		fmt.Fprintf(os.Stderr, "  -q, --quiet\n")
+		fmt.Fprintf(os.Stderr, "        Suppress per-file progress messages and warnings (errors are still printed)\n")
+		fmt.Fprintf(os.Stderr, "  --decode-names\n")
+		fmt.Fprintf(os.Stderr, "        Use Unicode Path extra fields or decode entry names that lack the UTF-8 flag as CP437\n")
+		fmt.Fprintf(os.Stderr, "  --normalize-backslashes\n")
+		fmt.Fprintf(os.Stderr, "        Treat backslashes in entry names as path separators, for archives from old Windows\n")
+		fmt.Fprintf(os.Stderr, "        tools, so that -f recreates directories and patterns match\n")
+		fmt.Fprintf(os.Stderr, "  --gunzip\n")
+		fmt.Fprintf(os.Stderr, "        If the url serves a gzip-compressed archive (.zip.gz), download it whole and\n")
+		fmt.Fprintf(os.Stderr, "        decompress it in memory instead of failing\n")
+		fmt.Fprintf(os.Stderr, "  --password-stdin\n")
+		fmt.Fprintf(os.Stderr, "        Read the password of encrypted files from the first line of stdin. Without it, the\n")
+		fmt.Fprintf(os.Stderr, "        password is asked for on the terminal when encrypted files are tested or extracted\n")
+		fmt.Fprintf(os.Stderr, "  --strip-components N\n")
+		fmt.Fprintf(os.Stderr, "        With -f, remove N leading path components, skipping entries with no more than N\n")
+		fmt.Fprintf(os.Stderr, "  --no-directory-creation\n")
+		fmt.Fprintf(os.Stderr, "        Fail on files whose output directory does not exist instead of creating it\n")
+		fmt.Fprintf(os.Stderr, "  --select-largest, --select-smallest\n")
+		fmt.Fprintf(os.Stderr, "        Of the matching files (all if no filenames given), only extract the largest or smallest\n")
+		fmt.Fprintf(os.Stderr, "  --content-type prefix\n")
+		fmt.Fprintf(os.Stderr, "        Only extract files whose content, sniffed with one small request each, has a MIME type\n")
+		fmt.Fprintf(os.Stderr, "        starting with prefix (e.g. image/), extracting all such files if no filenames are given\n")
+		fmt.Fprintf(os.Stderr, "  --min-size size, --max-size size\n")
+		fmt.Fprintf(os.Stderr, "        Only extract files whose uncompressed size is within the bounds, e.g. 500k or 1M\n")
+		fmt.Fprintf(os.Stderr, "        (binary units), extracting all such files if no filenames are given\n")
+		fmt.Fprintf(os.Stderr, "  --keep-going\n")
+		fmt.Fprintf(os.Stderr, "        Skip files that fail to extract, then list the failures and exit nonzero if there were any\n")
+		fmt.Fprintf(os.Stderr, "  --journal file\n")
+		fmt.Fprintf(os.Stderr, "        Record each file once written in file, starting it afresh unless --resume is given\n")
+		fmt.Fprintf(os.Stderr, "  --resume\n")
+		fmt.Fprintf(os.Stderr, "        With --journal, skip files the journal records, continuing an interrupted extraction\n")
+		fmt.Fprintf(os.Stderr, "  --resume-file\n")
+		fmt.Fprintf(os.Stderr, "        Extract the one file matching filenames in place, appending to a partial output file\n")
+		fmt.Fprintf(os.Stderr, "        left by an interrupted attempt if the entry is stored (compressed entries restart)\n")
+		fmt.Fprintf(os.Stderr, "  --repack out.zip\n")
+		fmt.Fprintf(os.Stderr, "        Copy the matching entries (all if no filenames given) into a new local zip file without\n")
+		fmt.Fprintf(os.Stderr, "        decompressing them, downloading only their compressed data\n")
+		fmt.Fprintf(os.Stderr, "  --newer-only\n")
+		fmt.Fprintf(os.Stderr, "        Skip entries whose modification time is not newer than the existing output file\n")
+		fmt.Fprintf(os.Stderr, "  --on-collision policy\n")
+		fmt.Fprintf(os.Stderr, "        Without -f, what to do when files from different directories share a name:\n")
+		fmt.Fprintf(os.Stderr, "        overwrite (default), rename (to \"name (1).ext\", reporting each rename) or error\n")
+		fmt.Fprintf(os.Stderr, "  --sort order\n")
+		fmt.Fprintf(os.Stderr, "        Extract matching files in archive (default), name or size order\n")
+		fmt.Fprintf(os.Stderr, "  --dirs-first\n")
+		fmt.Fprintf(os.Stderr, "        Extract directory entries before files\n")
+		fmt.Fprintf(os.Stderr, "  --list-long\n")
+		fmt.Fprintf(os.Stderr, "        List files with the offset and size of their compressed data (one request per file),\n")
+		fmt.Fprintf(os.Stderr, "        after the archive's disk numbers\n")
+		fmt.Fprintf(os.Stderr, "  --tree\n")
+		fmt.Fprintf(os.Stderr, "        List files as an indented directory tree with their sizes\n")
+		fmt.Fprintf(os.Stderr, "  --checksum\n")
+		fmt.Fprintf(os.Stderr, "        With -l, also show each entry's stored CRC-32 (blank for directories)\n")
+		fmt.Fprintf(os.Stderr, "  --max-connections N\n")
+		fmt.Fprintf(os.Stderr, "        Maximum number of connections to the server (default: unlimited, 10 kept idle)\n")
+		fmt.Fprintf(os.Stderr, "  --chunk-size N\n")
+		fmt.Fprintf(os.Stderr, "        Fetch the archive in aligned blocks of N bytes, caching the 16 most recently used\n")
+		fmt.Fprintf(os.Stderr, "  --estimate\n")
+		fmt.Fprintf(os.Stderr, "        Print how many bytes extracting the matching files (all if no filenames given) would\n")
+		fmt.Fprintf(os.Stderr, "        download, judged from the central directory, instead of extracting them\n")
+		fmt.Fprintf(os.Stderr, "  --stats\n")
+		fmt.Fprintf(os.Stderr, "        Print the number of requests, bytes downloaded and cache hit ratio when done\n")
+		fmt.Fprintf(os.Stderr, "  --ndjson\n")
+		fmt.Fprintf(os.Stderr, "        When extracting, print a JSON object per file to stdout with its name, action\n")
+		fmt.Fprintf(os.Stderr, "        (extracted, skipped or failed), bytes and any error, then a summary object\n")
 		os.Exit(1)
 	}
 
 	url := args[0]
 	filenames := args[1:]
 
-	// Create RemoteZipFile
-	rzf, err := NewRemoteZipFile(url)
+	if o.selectLargest && o.selectSmallest {
+		fmt.Fprintf(os.Stderr, "Error: --select-largest and --select-smallest are mutually exclusive\n")
+		os.Exit(1)
+	}
+	if o.pipe {
+		if len(filenames) == 0 && o.manifest == "" {
+			fmt.Fprintf(os.Stderr, "Error: -p needs the name of the file to write\n")
+			os.Exit(1)
+		}
+		o.writeStdout, o.quiet = true, true
+	}
+	if o.ndjson && o.writeStdout {
+		fmt.Fprintf(os.Stderr, "Error: --ndjson cannot be combined with -o or -p, which write to stdout\n")
+		os.Exit(1)
+	}
+	if o.resumeFile {
+		if len(filenames) == 0 && o.manifest == "" {
+			fmt.Fprintf(os.Stderr, "Error: --resume-file needs the name of the file to extract\n")
+			os.Exit(1)
+		}
+		if o.writeStdout {
+			fmt.Fprintf(os.Stderr, "Error: --resume-file cannot be combined with -o or -p\n")
+			os.Exit(1)
+		}
+	}
+	if o.repack != "" && (o.writeStdout || o.resumeFile || o.ndjson) {
+		fmt.Fprintf(os.Stderr, "Error: --repack cannot be combined with -o, -p, --resume-file or --ndjson\n")
+		os.Exit(1)
+	}
+	if o.passwordStdin && url == "-" {
+		fmt.Fprintf(os.Stderr, "Error: --password-stdin cannot be combined with reading the archive from stdin\n")
+		os.Exit(1)
+	}
+	if o.resume && o.journalPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: --resume requires --journal\n")
+		os.Exit(1)
+	}
+
+	order, err := parseSortOrder(o.sortOrder)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	onCollision, err := parseCollisionPolicy(o.onCollision)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var minBytes, maxBytes int64
+	if o.minSize != "" {
+		if minBytes, err = parseSize(o.minSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --min-size: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if o.maxSize != "" {
+		if maxBytes, err = parseSize(o.maxSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --max-size: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if o.manifest != "" {
+		patterns, err := readManifest(o.manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		filenames = append(filenames, patterns...)
+	}
+
+	opts := Options{
+		MaxConnections:       o.maxConnections,
+		DecodeNames:          o.decodeNames,
+		NormalizeBackslashes: o.normalizeBackslashes,
+		ChunkSize:            o.chunkSize,
+		GunzipFallback:       o.gunzip,
+	}
+	if !o.quiet {
+		opts.Logger = newStderrLogger()
+	}
+	if o.passwordStdin {
+		if opts.Password, err = readPasswordLine(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Create RemoteZipFile, buffering the archive from stdin for "-"
+	var rzf *RemoteZipFile
+	if url == "-" {
+		if !o.quiet {
+			fmt.Fprintf(os.Stderr, "Warning: reading the whole archive from stdin into memory\n")
+		}
+		rzf, err = NewFromReader(os.Stdin, WithOptions(opts))
+	} else {
+		rzf, err = NewRemoteZipFileWithOptions(url, opts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 	defer rzf.Close()
+	if o.showStats {
+		defer printStats(rzf)
+	}
+
+	if o.listLong {
+		if err := listZipContentsLong(rzf, filenames, o.excludes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if o.tree {
+		listZipTree(rzf, filenames, o.excludes)
+		return
+	}
+
+	// Content types are only sniffed when extracting, so without filenames
+	// consider every entry rather than listing them. The size filters apply
+	// to extraction too, and the extract command and --repack take everything.
+	if (o.extractAll || o.repack != "" || o.contentType != "" || minBytes > 0 || maxBytes > 0) && len(filenames) == 0 {
+		filenames = []string{"**"}
+	}
+
+	// Narrow the matches down to a single file by size. Everything from here
+	// on only considers that file, rather than matching its name, which can
+	// be shared by other entries or contain a * matching them.
+	files := rzf.Files()
+	picked := o.selectLargest || o.selectSmallest
+	if picked {
+		f := selectBySize(rzf, filenames, o.excludes, minBytes, maxBytes, o.selectLargest)
+		if f == nil {
+			fmt.Fprintf(os.Stderr, "Error: no files matched\n")
+			os.Exit(1)
+		}
+		files, filenames = []*zip.File{f}, []string{"**"}
+	}
+
+	if o.estimate {
+		if err := printEstimate(rzf, files, filenames, o.excludes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if o.repack != "" {
+		n, err := repackMatching(rzf, o.repack, files, filenames, o.excludes, minBytes, maxBytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !o.quiet {
+			fmt.Fprintf(os.Stderr, "%d entries repacked into %s\n", n, o.repack)
+		}
+		return
+	}
+
+	// Ask for a password once the directory shows that files about to be
+	// decrypted need one
+	reading := o.testArchive || !o.listFiles && len(filenames) > 0
+	if reading && opts.Password == "" && needsPassword(rzf, files, filenames, o.excludes) {
+		password, err := promptPassword()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		rzf.opts.Password = password
+	}
+
+	if o.testArchive {
+		if testFiles(rzf, files, filenames, o.excludes, o.quiet) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// If no filenames provided or -l flag is set, list files
-	if *listFiles || len(filenames) == 0 {
-		listZipContents(rzf)
+	if o.listFiles || len(filenames) == 0 {
+		listZipContents(rzf, files, filenames, o.excludes, o.checksum)
 		return
 	}
 
-	// Extract requested files
+	// Every pattern would fail to match; say why once instead
+	if len(rzf.Files()) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: archive is empty\n")
+		os.Exit(1)
+	}
+
+	if o.pipe {
+		if n := countMatches(rzf, files, filenames, o.excludes, minBytes, maxBytes); n > 1 {
+			fmt.Fprintf(os.Stderr, "Error: -p needs exactly one file, but %d match\n", n)
+			os.Exit(1)
+		}
+	}
+	if o.resumeFile {
+		if n := countMatches(rzf, files, filenames, o.excludes, minBytes, maxBytes); n != 1 {
+			fmt.Fprintf(os.Stderr, "Error: --resume-file needs exactly one file, but %d match\n", n)
+			os.Exit(1)
+		}
+	}
+
+	extractOpts := ExtractOptions{
+		RecreateStructure:   o.recreateStructure,
+		StripComponents:     o.stripComponents,
+		NoDirectoryCreation: o.noDirCreation,
+		NewerOnly:           o.newerOnly,
+		Excludes:            o.excludes,
+		ContentType:         o.contentType,
+		MinSize:             minBytes,
+		MaxSize:             maxBytes,
+		OnCollision:         onCollision,
+		Order:               order,
+		DirsFirst:           o.dirsFirst,
+		KeepGoing:           o.keepGoing,
+	}
+	if o.journalPath != "" && !o.writeStdout {
+		journal, err := OpenJournal(o.journalPath, o.resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer journal.Close()
+		extractOpts.Journal = journal
+	}
+	if !o.quiet {
+		extractOpts.Progress = func(name string) {
+			fmt.Fprintf(os.Stderr, "Extracting %s...\n", name)
+		}
+	}
+	// Renames are reported even with -q, as files end up under names
+	// that do not appear in the archive
+	if !o.ndjson {
+		extractOpts.Renamed = func(name, path string) {
+			fmt.Fprintf(os.Stderr, "Renamed %s to %s to avoid overwriting a file of the same name\n", name, path)
+		}
+	}
+	ex := rzf.newExtractor(".", extractOpts)
+	if picked {
+		ex.files = files
+	}
+	if o.resumeFile {
+		if err := resumeMatch(ex, filenames, o.quiet); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if o.writeStdout {
+		ex.stdout = os.Stdout
+	}
+	var events *eventWriter
+	if o.ndjson {
+		events = newEventWriter(os.Stdout)
+		ex.report = events.entry
+	}
+
+	// Extract requested files. A name without wildcards that matches
+	// nothing is most likely a typo, and fails the run once the rest is done.
+	missing := 0
 	for _, pattern := range filenames {
-		if err := extractFiles(rzf, pattern, *recreateStructure, *writeStdout); err != nil {
+		err := ex.extract(pattern)
+		if errors.Is(err, ErrNotFound) && !strings.Contains(pattern, "*") {
+			if suggestion := suggestName(rzf, pattern); suggestion != "" {
+				fmt.Fprintf(os.Stderr, "Error: %s not found in archive; did you mean %s?\n", pattern, suggestion)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %s not found in archive\n", pattern)
+			}
+			missing++
+			if events != nil {
+				events.entry(extractEvent{name: pattern, action: "failed", err: err})
+			}
+		} else if err != nil {
 			fmt.Fprintf(os.Stderr, "Error extracting %s: %v\n", pattern, err)
 		}
 	}
+
+	if o.newerOnly && !o.quiet {
+		fmt.Fprintf(os.Stderr, "%d extracted, %d skipped as up to date\n", ex.written, ex.upToDate)
+	}
+	if o.resume && !o.quiet {
+		fmt.Fprintf(os.Stderr, "%d extracted, %d already done according to the journal\n", ex.written, ex.resumed)
+	}
+
+	if o.keepGoing {
+		for _, err := range ex.failed {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if !o.quiet {
+			fmt.Fprintf(os.Stderr, "%d extracted, %d failed\n", ex.written, len(ex.failed))
+		}
+	}
+
+	if events != nil {
+		events.summary()
+	}
+
+	if missing > 0 || len(ex.failed) > 0 {
+		os.Exit(1)
+	}
 }
 
-func listZipContents(rzf *RemoteZipFile) {
-	fmt.Printf("%-10s  %-19s  %s\n", "Length", "DateTime", "Name")
-	fmt.Println(strings.Repeat("-", 60))
+// eventWriter prints --ndjson events, one JSON object per line, and counts
+// them for the final summary event
+type eventWriter struct {
+	enc                        *json.Encoder
+	extracted, skipped, failed int
+	bytes                      int64
+}
 
-	for _, f := range rzf.Files() {
-		fmt.Printf("%-10d  %s  %s\n",
-			f.UncompressedSize64,
-			f.Modified.Format("2006-01-02 15:04:05"),
-			f.Name)
+type entryEvent struct {
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Bytes     int64  `json:"bytes"`
+	Reason    string `json:"reason,omitempty"`
+	RenamedTo string `json:"renamed_to,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type summaryEvent struct {
+	Action    string `json:"action"`
+	Extracted int    `json:"extracted"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	Bytes     int64  `json:"bytes"`
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *eventWriter) entry(ev extractEvent) {
+	switch ev.action {
+	case "extracted":
+		w.extracted++
+		w.bytes += ev.bytes
+	case "skipped":
+		w.skipped++
+	case "failed":
+		w.failed++
+	}
+	out := entryEvent{Name: ev.name, Action: ev.action, Bytes: ev.bytes, Reason: ev.reason, RenamedTo: ev.path}
+	if ev.err != nil {
+		out.Error = ev.err.Error()
 	}
+	w.enc.Encode(out)
 }
 
-func extractFiles(rzf *RemoteZipFile, pattern string, recreateStructure, writeStdout bool) error {
-	matched := false
+// summary prints the terminal event with the totals
+func (w *eventWriter) summary() {
+	w.enc.Encode(summaryEvent{Action: "summary", Extracted: w.extracted, Skipped: w.skipped, Failed: w.failed, Bytes: w.bytes})
+}
 
+// selectBySize returns the largest (or smallest) file by uncompressed size
+// among those selected by the patterns and size bounds, the first in archive
+// order on ties, or nil if no file is selected. Directories are never
+// chosen.
+func selectBySize(rzf *RemoteZipFile, includes, excludes []string, minSize, maxSize int64, largest bool) *zip.File {
+	sizes := ExtractOptions{MinSize: minSize, MaxSize: maxSize}
+	var best *zip.File
 	for _, f := range rzf.Files() {
-		// Normalize the file name from the ZIP (always uses forward slashes)
-		normalizedName := filepath.FromSlash(f.Name)
-		
-		// Simple pattern matching (supports * wildcard)
-		if matchPattern(pattern, f.Name) || matchPattern(pattern, normalizedName) {
-			matched = true
-
-			if f.FileInfo().IsDir() {
-				continue
+		if f.FileInfo().IsDir() || !selected(rzf.DisplayName(f), includes, excludes) || !sizes.sizeSelected(f) {
+			continue
+		}
+		if best == nil ||
+			(largest && f.UncompressedSize64 > best.UncompressedSize64) ||
+			(!largest && f.UncompressedSize64 < best.UncompressedSize64) {
+			best = f
+		}
+	}
+	return best
+}
+
+// countMatches returns how many of files, not counting directories, are
+// selected by the patterns and size bounds
+func countMatches(rzf *RemoteZipFile, files []*zip.File, includes, excludes []string, minSize, maxSize int64) int {
+	sizes := ExtractOptions{MinSize: minSize, MaxSize: maxSize}
+	n := 0
+	for _, f := range files {
+		if !f.FileInfo().IsDir() && selected(rzf.DisplayName(f), includes, excludes) && sizes.sizeSelected(f) {
+			n++
+		}
+	}
+	return n
+}
+
+// resumeMatch extracts the one file selected by includes and ex's options
+// with ResumeExtract, to the path ExtractMatching would use, for
+// --resume-file
+func resumeMatch(ex *extractor, includes []string, quiet bool) error {
+	rzf := ex.rzf
+	for _, f := range ex.files {
+		name := rzf.DisplayName(f)
+		if f.FileInfo().IsDir() || !selected(name, includes, ex.opts.Excludes) || !ex.opts.sizeSelected(f) {
+			continue
+		}
+
+		relPath, ok := ex.relativePath(name)
+		if !ok {
+			return fmt.Errorf("--strip-components leaves nothing of %s", name)
+		}
+		if !filepath.IsLocal(relPath) {
+			return fmt.Errorf("refusing to extract %s outside the destination directory", name)
+		}
+		if dir := filepath.Dir(relPath); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", dir, err)
+			}
+		}
+
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Extracting %s...\n", name)
+		}
+		offset, err := rzf.resumeExtract(f, relPath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case quiet || offset == 0:
+		case uint64(offset) == f.UncompressedSize64:
+			fmt.Fprintf(os.Stderr, "%s was already complete\n", relPath)
+		default:
+			fmt.Fprintf(os.Stderr, "Resumed %s at byte %d of %d\n", relPath, offset, f.UncompressedSize64)
+		}
+		return nil
+	}
+	return fmt.Errorf("no files matched")
+}
+
+// newStderrLogger returns a logger that prints library warnings to stderr,
+// without timestamps
+func newStderrLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelWarn,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
 			}
+			return a
+		},
+	}))
+}
+
+// printEstimate prints the estimated download for extracting those of files
+// selected by the patterns, next to the size of the whole archive for
+// comparison. Like EstimateDownload, it fails if a pattern matches nothing.
+func printEstimate(rzf *RemoteZipFile, files []*zip.File, includes, excludes []string) error {
+	if _, err := rzf.EstimateDownload(includes, excludes...); err != nil {
+		return err
+	}
+	var size int64
+	for _, f := range files {
+		if selected(rzf.DisplayName(f), includes, excludes) {
+			size += downloadSize(f)
+		}
+	}
+	n := countMatches(rzf, files, includes, excludes, 0, 0)
+	fmt.Printf("%d files, about %d bytes to download (archive is %d bytes)\n", n, size, rzf.size)
+	return nil
+}
+
+// testFiles decompresses those of files selected by the patterns without
+// keeping their contents, which checks each against its CRC-32 and recorded
+// size, printing OK or the error per file (failures only with quiet) and a
+// summary like unzip -t. It returns the number of files that failed.
+func testFiles(rzf *RemoteZipFile, files []*zip.File, includes, excludes []string, quiet bool) int {
+	var tested, failed int
+	for _, f := range files {
+		name := rzf.DisplayName(f)
+		if f.FileInfo().IsDir() || !selected(name, includes, excludes) {
+			continue
+		}
+		tested++
+		if _, err := rzf.extractFileTo(f, io.Discard); err != nil {
+			failed++
+			fmt.Printf("    testing: %s  %v\n", name, err)
+		} else if !quiet {
+			fmt.Printf("    testing: %s  OK\n", name)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d files failed\n", failed, tested)
+	} else {
+		fmt.Printf("No errors detected in %d files\n", tested)
+	}
+	return failed
+}
+
+// repackMatching writes those of entries selected by includes, excludes and
+// the size bounds to a new archive at path with Repack, for --repack. Directory
+// entries are kept if selected, whatever the bounds. The archive is written
+// to a temporary file that replaces path once complete. It returns the
+// number of entries written.
+func repackMatching(rzf *RemoteZipFile, path string, entries []*zip.File, includes, excludes []string, minSize, maxSize int64) (int, error) {
+	sizes := ExtractOptions{MinSize: minSize, MaxSize: maxSize}
+	var files []*zip.File
+	for _, f := range entries {
+		if !selected(rzf.DisplayName(f), includes, excludes) {
+			continue
+		}
+		if f.FileInfo().IsDir() || sizes.sizeSelected(f) {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no files matched")
+	}
+
+	tmpPath, out, err := createTemp(OSFS{}, path, 0666)
+	if err != nil {
+		return 0, err
+	}
+	err = rzf.Repack(out, files)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return len(files), nil
+}
+
+// printStats writes the --stats summary to stderr
+func printStats(rzf *RemoteZipFile) {
+	stats := rzf.Stats()
+	fmt.Fprintf(os.Stderr, "%d requests, %d bytes downloaded\n", stats.Requests, stats.BytesFetched)
+	if rzf.opts.ChunkSize > 0 {
+		fmt.Fprintf(os.Stderr, "cache: %d hits, %d misses (%.1f%% hit ratio), %d evictions, %d bytes served from cache\n",
+			stats.CacheHits, stats.CacheMisses, 100*stats.CacheHitRatio(), stats.CacheEvictions, stats.BytesFromCache)
+	}
+}
+
+// parseSize parses a byte count with an optional binary unit suffix, such
+// as 4096, 500k, 1.5M or 2GiB
+func parseSize(s string) (int64, error) {
+	number := strings.TrimRight(strings.TrimSpace(s), "BbIi")
+	multiplier := int64(1)
+	if number != "" {
+		if i := strings.IndexByte("KMGT", byte(unicode.ToUpper(rune(number[len(number)-1])))); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			number = number[:len(number)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// parseSortOrder maps the value of --sort to a SortOrder
+func parseSortOrder(s string) (SortOrder, error) {
+	switch s {
+	case "archive":
+		return SortArchive, nil
+	case "name":
+		return SortName, nil
+	case "size":
+		return SortSize, nil
+	}
+	return 0, fmt.Errorf("unknown sort order %q (want archive, name or size)", s)
+}
+
+// suggestName returns the name of the one file whose name contains name,
+// ignoring case, or "" if there is no such file or several
+func suggestName(rzf *RemoteZipFile, name string) string {
+	var suggestion string
+	for _, f := range rzf.FindByPartial(name, true) {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if suggestion != "" {
+			return ""
+		}
+		suggestion = rzf.DisplayName(f)
+	}
+	return suggestion
+}
+
+// parseCollisionPolicy maps the value of --on-collision to a CollisionPolicy
+func parseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch s {
+	case "overwrite":
+		return CollisionOverwrite, nil
+	case "rename":
+		return CollisionRename, nil
+	case "error":
+		return CollisionError, nil
+	}
+	return 0, fmt.Errorf("unknown collision policy %q (want overwrite, rename or error)", s)
+}
 
-			if writeStdout {
-				// Write to stdout
-				data, err := rzf.Extract(f.Name)
-				if err != nil {
-					return fmt.Errorf("failed to extract %s: %w", f.Name, err)
-				}
-				os.Stdout.Write(data)
+// readManifest reads the patterns listed one per line in a manifest file,
+// skipping blank lines and lines starting with #
+func readManifest(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no files", path)
+	}
+	return patterns, nil
+}
+
+// patternList is a flag.Value collecting the patterns of a repeated flag
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(pattern string) error {
+	*p = append(*p, pattern)
+	return nil
+}
+
+// selected reports whether name matches one of the include patterns (or
+// there are none) and none of the exclude patterns
+func selected(name string, includes, excludes []string) bool {
+	for _, pattern := range excludes {
+		if matchPattern(pattern, name) {
+			return false
+		}
+	}
+	if len(includes) == 0 {
+		return true
+	}
+	for _, pattern := range includes {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// listZipContents prints those of files selected by the include and exclude
+// patterns, or all of them when there are no patterns. With checksum, the
+// CRC-32 stored in the central directory is shown too, which is enough to
+// compare two archives' contents without downloading any file data.
+func listZipContents(rzf *RemoteZipFile, files []*zip.File, includes, excludes []string, checksum bool) {
+	if checksum {
+		fmt.Printf("%-10s  %-19s  %-8s  %s\n", "Length", "DateTime", "CRC-32", "Name")
+	} else {
+		fmt.Printf("%-10s  %-19s  %s\n", "Length", "DateTime", "Name")
+	}
+	fmt.Println(strings.Repeat("-", 60))
+
+	for _, f := range files {
+		if !selected(rzf.DisplayName(f), includes, excludes) {
+			continue
+		}
+		modified := f.Modified.Format("2006-01-02 15:04:05")
+		if !checksum {
+			fmt.Printf("%-10d  %s  %s\n", f.UncompressedSize64, modified, rzf.DisplayName(f))
+			continue
+		}
+		// Directories have no data and so no meaningful CRC
+		crc := ""
+		if !f.FileInfo().IsDir() {
+			crc = fmt.Sprintf("%08x", f.CRC32)
+		}
+		fmt.Printf("%-10d  %s  %-8s  %s\n", f.UncompressedSize64, modified, crc, rzf.DisplayName(f))
+	}
+}
+
+// treeNode is a directory or file in the tree printed by listZipTree
+type treeNode struct {
+	size     uint64
+	isDir    bool
+	children map[string]*treeNode
+}
+
+// listZipTree prints the selected entries as an indented tree, like the tree
+// command. Directories are derived from the slash-separated names, so they
+// appear whether or not the archive has explicit records for them.
+func listZipTree(rzf *RemoteZipFile, includes, excludes []string) {
+	root := &treeNode{isDir: true, children: map[string]*treeNode{}}
+	for _, f := range rzf.Files() {
+		name := rzf.DisplayName(f)
+		if !selected(name, includes, excludes) {
+			continue
+		}
+
+		parts := strings.Split(strings.TrimSuffix(name, "/"), "/")
+		node := root
+		for i, part := range parts {
+			child := node.children[part]
+			if child == nil {
+				child = &treeNode{children: map[string]*treeNode{}}
+				node.children[part] = child
+			}
+			if i < len(parts)-1 || f.FileInfo().IsDir() {
+				child.isDir = true
 			} else {
-				// Write to file
-				outputPath := normalizedName
-				if !recreateStructure {
-					outputPath = filepath.Base(normalizedName)
-				}
-
-				// Create directory structure if needed
-				dir := filepath.Dir(outputPath)
-				if dir != "." && dir != "" {
-					if err := os.MkdirAll(dir, 0755); err != nil {
-						return fmt.Errorf("failed to create directory %s: %w", dir, err)
-					}
-				}
-
-				fmt.Fprintf(os.Stderr, "Extracting %s...\n", f.Name)
-
-				data, err := rzf.Extract(f.Name)
-				if err != nil {
-					return fmt.Errorf("failed to extract %s: %w", f.Name, err)
-				}
-
-				if err := os.WriteFile(outputPath, data, 0644); err != nil {
-					return fmt.Errorf("failed to write %s: %w", outputPath, err)
-				}
+				child.size = f.UncompressedSize64
 			}
+			node = child
 		}
 	}
 
-	if !matched {
-		return fmt.Errorf("no files matched pattern: %s", pattern)
+	fmt.Println(".")
+	printTree(root, "")
+}
+
+// printTree prints the children of node sorted by name, each line prefixed
+// with indent
+func printTree(node *treeNode, indent string) {
+	names := slices.Sorted(maps.Keys(node.children))
+	for i, name := range names {
+		child := node.children[name]
+		branch, nextIndent := "├── ", indent+"│   "
+		if i == len(names)-1 {
+			branch, nextIndent = "└── ", indent+"    "
+		}
+		if child.isDir {
+			fmt.Printf("%s%s%s/\n", indent, branch, name)
+			printTree(child, nextIndent)
+		} else {
+			fmt.Printf("%s%s%s (%d)\n", indent, branch, name, child.size)
+		}
+	}
+}
+
+// listZipContentsLong prints where each entry's compressed data lives in the
+// archive, i.e. the byte range [Offset, Offset+Compressed). Locating the data
+// requires reading each local file header, so this costs one request per entry.
+// A first line gives the disk fields of the End of Central Directory record.
+func listZipContentsLong(rzf *RemoteZipFile, includes, excludes []string) error {
+	disks := rzf.Disks()
+	fmt.Printf("Disk %d, central directory on disk %d", disks.Disk, disks.DirectoryDisk)
+	if disks.TotalDisks > 0 {
+		fmt.Printf(", %d disks in total", disks.TotalDisks)
+	}
+	fmt.Printf("\n\n")
+	fmt.Printf("%-12s  %-10s  %-10s  %-6s  %s\n", "Offset", "Compressed", "Length", "Method", "Name")
+	fmt.Println(strings.Repeat("-", 60))
+
+	for _, f := range rzf.Files() {
+		if !selected(rzf.DisplayName(f), includes, excludes) {
+			continue
+		}
+		offset, err := f.DataOffset()
+		if err != nil {
+			return fmt.Errorf("failed to locate data for %s: %w", f.Name, err)
+		}
+		fmt.Printf("%-12d  %-10d  %-10d  %-6d  %s\n",
+			offset,
+			f.CompressedSize64,
+			f.UncompressedSize64,
+			f.Method,
+			rzf.DisplayName(f))
 	}
 
 	return nil
 }
 
-// Simple pattern matching with * wildcard support
+// Pattern matching with wildcards: * matches within one path level, **
+// across levels, and a pattern ending in / matches that directory and
+// everything below it. A directory entry's trailing / is ignored otherwise,
+// so "docs/*" matches both "docs/a.txt" and the directory "docs/sub/".
 func matchPattern(pattern, name string) bool {
 	// Normalize both pattern and name to use forward slashes for comparison
 	pattern = filepath.ToSlash(pattern)
@@ -131,14 +909,36 @@ func matchPattern(pattern, name string) bool {
 		return true
 	}
 
-	// Handle wildcard patterns
-	if strings.Contains(pattern, "*") {
-		parts := strings.Split(pattern, "*")
-		if len(parts) == 2 {
-			// Simple prefix*suffix matching
-			return strings.HasPrefix(name, parts[0]) && strings.HasSuffix(name, parts[1])
-		}
+	// A directory prefix selects the whole subtree
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(name, pattern)
 	}
 
+	return globMatch(pattern, strings.TrimSuffix(name, "/"))
+}
+
+// globMatch matches name against pattern, in which * stands for any run of
+// characters other than / and ** for any run at all
+func globMatch(pattern, name string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, pattern[:star]) {
+		return false
+	}
+	name = name[star:]
+	rest := strings.TrimLeft(pattern[star:], "*")
+	recursive := len(pattern)-star-len(rest) > 1
+
+	// Try every possible length of the starred run, shortest first
+	for i := 0; i <= len(name); i++ {
+		if globMatch(rest, name[i:]) {
+			return true
+		}
+		if i < len(name) && name[i] == '/' && !recursive {
+			return false
+		}
+	}
 	return false
 }
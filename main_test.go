@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchPatternDepth(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"docs/*", "docs/a.txt", true},
+		{"docs/*", "docs/sub/", true},
+		{"docs/*", "docs/sub/b.txt", false},
+		{"docs/**", "docs/a.txt", true},
+		{"docs/**", "docs/sub/b.txt", true},
+		{"docs/**", "docs/sub/deep/c.txt", true},
+		{"docs/**", "other/a.txt", false},
+		{"docs/", "docs/sub/deep/c.txt", true},
+		{"*.txt", "a.txt", true},
+		{"*.txt", "docs/a.txt", false},
+		{"**.txt", "docs/sub/b.txt", true},
+		{"docs/*/b.txt", "docs/sub/b.txt", true},
+		{"docs/*/b.txt", "docs/sub/deep/b.txt", false},
+	} {
+		if got := matchPattern(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+// docsZip holds files one and two levels below docs/
+func docsZip(t *testing.T) []byte {
+	return buildZip(t,
+		testFile{name: "docs/a.txt", body: "a"},
+		testFile{name: "docs/sub/b.txt", body: "b"},
+		testFile{name: "readme.md", body: "r"},
+	)
+}
+
+func TestExtractMatchingDepth(t *testing.T) {
+	srv := newTestServer(t, docsZip(t))
+	rzf := openTest(t, srv.URL)
+
+	for pattern, want := range map[string][]string{
+		"docs/*":  {"docs/a.txt"},
+		"docs/**": {"docs/a.txt", "docs/sub/b.txt"},
+		"docs/":   {"docs/a.txt", "docs/sub/b.txt"},
+	} {
+		dest := t.TempDir()
+		if err := rzf.ExtractMatching(pattern, dest, ExtractOptions{RecreateStructure: true}); err != nil {
+			t.Fatal(err)
+		}
+		if got := walkFiles(t, dest); !slices.Equal(got, want) {
+			t.Errorf("%s extracted %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestFiltersWithoutFilenamesAreRecursive(t *testing.T) {
+	srv := newTestServer(t, docsZip(t))
+	for _, filter := range [][]string{{"--content-type", "text/"}, {"--min-size", "1"}, {"--max-size", "1M"}} {
+		dest := t.TempDir()
+		args := append(append([]string{"-q", "-f"}, filter...), srv.URL)
+		if _, stderr, code := runMain(t, dest, args...); code != 0 {
+			t.Fatalf("%v: exit code %d: %s", filter, code, stderr)
+		}
+		want := []string{"docs/a.txt", "docs/sub/b.txt", "readme.md"}
+		if got := walkFiles(t, dest); !slices.Equal(got, want) {
+			t.Errorf("%v extracted %q, want %q", filter, got, want)
+		}
+	}
+}
+
+// walkFiles returns the paths of the regular files below dir, relative to
+// it and with forward slashes, in lexical order
+func walkFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSelectBySizeHonoursSizeBounds(t *testing.T) {
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "small.txt", body: "s"},
+		testFile{name: "medium.txt", body: strings.Repeat("m", 100)},
+		testFile{name: "large.txt", body: strings.Repeat("l", 3000)},
+	))
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--select-largest", "--max-size", "1K"}, "medium.txt"},
+		{[]string{"--select-smallest", "--min-size", "50"}, "medium.txt"},
+		{[]string{"--select-largest"}, "large.txt"},
+	} {
+		dest := t.TempDir()
+		args := append(append([]string{"-q"}, tc.args...), srv.URL)
+		if _, stderr, code := runMain(t, dest, args...); code != 0 {
+			t.Fatalf("%v: exit code %d: %s", tc.args, code, stderr)
+		}
+		if got := walkFiles(t, dest); !slices.Equal(got, []string{tc.want}) {
+			t.Errorf("%v extracted %q, want %s", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestSelectBySizeExtractsOnlyThePick(t *testing.T) {
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "logs/*.txt", body: strings.Repeat("l", 300)},
+		testFile{name: "logs/a.txt", body: "a"},
+		testFile{name: "data.bin", body: "short"},
+		testFile{name: "data.bin", body: strings.Repeat("d", 500)},
+	))
+
+	// The pick's name matches logs/a.txt too as a pattern
+	dest := t.TempDir()
+	if _, stderr, code := runMain(t, dest, "-q", "--select-largest", srv.URL, "logs/**"); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if got := walkFiles(t, dest); !slices.Equal(got, []string{"*.txt"}) {
+		t.Errorf("extracted %q, want only *.txt", got)
+	}
+
+	// Of two entries of the same name, only the larger is written
+	stdout, stderr, code := runMain(t, t.TempDir(), "-p", "--select-largest", srv.URL, "data.bin")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if want := strings.Repeat("d", 500); stdout != want {
+		t.Errorf("-p wrote %q, want the larger data.bin", stdout)
+	}
+}
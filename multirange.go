@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// byteRange is the half-open range [start, end) of the archive
+type byteRange struct {
+	start, end int64
+}
+
+// rangePart is one part of a multipart/byteranges response
+type rangePart struct {
+	start int64
+	data  []byte
+}
+
+// multiRangeSupport caches whether the server answers multi-range requests,
+// probed on first use
+type multiRangeSupport struct {
+	once sync.Once
+	ok   bool
+}
+
+// getRanges fetches several ranges of the archive: with a single request
+// when Options.MultiRange is set and the server supports multi-range
+// requests, and with a request per range otherwise. Ranges the multipart
+// response leaves out, or that it failed to deliver, are fetched separately.
+func (rzf *RemoteZipFile) getRanges(ranges []byteRange) ([][]byte, error) {
+	ctx := context.Background()
+	result := make([][]byte, len(ranges))
+
+	if rzf.opts.MultiRange && rzf.state().local == nil && rzf.overHTTP() && len(ranges) > 1 && rzf.supportsMultiRange(ctx) {
+		parts, err := rzf.fetchMultiRange(ctx, ranges)
+		if err != nil {
+			rzf.opts.logger().Debug("multi-range request failed, fetching ranges separately", "error", err)
+		}
+		for i, r := range ranges {
+			for _, p := range parts {
+				if r.start >= p.start && r.end <= p.start+int64(len(p.data)) {
+					result[i] = p.data[r.start-p.start : r.end-p.start]
+					break
+				}
+			}
+		}
+	}
+
+	for i, r := range ranges {
+		if result[i] != nil {
+			continue
+		}
+		data, err := rzf.getRange(r.start, r.end)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = data
+	}
+	return result, nil
+}
+
+// supportsMultiRange reports whether the server answers a request for the
+// first and last byte of the archive with a multipart/byteranges response.
+// The probe is made once.
+func (rzf *RemoteZipFile) supportsMultiRange(ctx context.Context) bool {
+	rzf.multiRange.once.Do(func() {
+		size := rzf.state().size
+		if size < 2 {
+			return
+		}
+		parts, err := rzf.fetchMultiRange(ctx, []byteRange{{0, 1}, {size - 1, size}})
+		if err != nil {
+			rzf.opts.logger().Debug("multi-range probe failed", "error", err)
+			return
+		}
+		rzf.multiRange.ok = parts != nil
+		rzf.opts.logger().Debug("probed multi-range support", "supported", rzf.multiRange.ok)
+	})
+	return rzf.multiRange.ok
+}
+
+// fetchMultiRange requests all of ranges at once and returns the parts of
+// the multipart/byteranges response, which need not line up with ranges:
+// servers may merge or reorder them. It returns no parts and no error if the
+// server answered with the whole file or a single range instead, closing the
+// response without reading it. On a read error, the parts received so far
+// are returned along with it.
+func (rzf *RemoteZipFile) fetchMultiRange(ctx context.Context, ranges []byteRange) ([]rangePart, error) {
+	req, err := newRequest(rzf.opts.rangeMethod(), rzf.URL, rzf.opts.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]string, len(ranges))
+	var total int64
+	for i, r := range ranges {
+		specs[i] = fmt.Sprintf("%d-%d", r.start, r.end-1)
+		total += r.end - r.start
+	}
+	req.Header.Set("Range", "bytes="+strings.Join(specs, ","))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	if err := rzf.byteLimit.wait(ctx, float64(total)); err != nil {
+		return nil, err
+	}
+
+	resp, err := rzf.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" || params["boundary"] == "" {
+		return nil, nil
+	}
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" && ce != "identity" {
+		return nil, fmt.Errorf("server applied Content-Encoding %q to a range response", ce)
+	}
+
+	timeout := rzf.opts.IdleTimeout
+	if timeout == 0 {
+		timeout = defaultIdleTimeout
+	}
+	var body io.Reader = resp.Body
+	if timeout > 0 {
+		idle := newIdleTimeoutReader(resp.Body, timeout, cancel)
+		defer idle.stop()
+		body = idle
+	}
+
+	var parts []rangePart
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return parts, err
+		}
+
+		first, last, size, err := parseContentRange(part.Header.Get("Content-Range"))
+		if err != nil {
+			return parts, err
+		}
+		if want := rzf.state().size; size >= 0 && size != want {
+			return nil, fmt.Errorf("%w: size is now %d, was %d", ErrFileChanged, size, want)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, last-first+1))
+		rzf.stats.bytesFetched.Add(int64(len(data)))
+		if err == nil && int64(len(data)) < last-first+1 {
+			err = fmt.Errorf("server returned %d of %d bytes of part %d-%d: %w", len(data), last-first+1, first, last, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return parts, err
+		}
+		parts = append(parts, rangePart{start: first, data: data})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+)
+
+// unicodePathExtraID is the Info-ZIP Unicode Path extra field
+const unicodePathExtraID = 0x7075
+
+// cp437High maps bytes 0x80-0xFF of code page 437 to Unicode. The lower half
+// of CP437 matches ASCII.
+var cp437High = []rune("ÇüéâäàåçêëèïîìÄÅ" +
+	"ÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧" +
+	"╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩" +
+	"≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ ")
+
+// DecodeCP437 converts a name stored in code page 437, the encoding the ZIP
+// specification prescribes for entries without the UTF-8 flag, to UTF-8
+func DecodeCP437(name string) string {
+	var sb strings.Builder
+	sb.Grow(len(name))
+	for i := 0; i < len(name); i++ {
+		if b := name[i]; b < 0x80 {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteRune(cp437High[b-0x80])
+		}
+	}
+	return sb.String()
+}
+
+// DisplayName returns the name of f for display and matching. With the
+// DecodeNames option, a UTF-8 name from the Info-ZIP Unicode Path extra
+// field is preferred, and otherwise names of entries lacking the UTF-8 flag
+// are decoded from their legacy encoding. Without it, this is f.Name.
+func (rzf *RemoteZipFile) DisplayName(f *zip.File) string {
+	if !rzf.opts.DecodeNames {
+		return f.Name
+	}
+	if name, ok := unicodePath(f); ok {
+		return name
+	}
+	if !f.NonUTF8 {
+		return f.Name
+	}
+
+	decode := rzf.opts.NameDecoder
+	if decode == nil {
+		decode = DecodeCP437
+	}
+	return decode(f.Name)
+}
+
+// unicodePath returns the name stored in f's Unicode Path extra field. The
+// field is ignored if its CRC does not match the header's name, which means
+// the name was changed by a tool unaware of the field.
+func unicodePath(f *zip.File) (string, bool) {
+	data, ok := extraField(f.Extra, unicodePathExtraID)
+	if !ok || len(data) < 5 || data[0] != 1 {
+		return "", false
+	}
+	if binary.LittleEndian.Uint32(data[1:5]) != crc32.ChecksumIEEE([]byte(f.Name)) {
+		return "", false
+	}
+	return string(data[5:]), true
+}
+
+// extraField returns the data of the first extra field with the given tag
+func extraField(extra []byte, tag uint16) ([]byte, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == tag {
+			return extra[:size], true
+		}
+		extra = extra[size:]
+	}
+	return nil, false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// cp437Zip is an archive whose names are stored in code page 437 without
+// the UTF-8 flag, as old DOS and Windows tools wrote them: "café.txt" and
+// "ÄLTERE/öl.txt"
+func cp437Zip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range []string{"caf\x82.txt", "\x8eLTERE/\x94l.txt"} {
+		out, err := w.CreateHeader(&zip.FileHeader{Name: name, NonUTF8: true, Modified: testModified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write([]byte(name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeCP437(t *testing.T) {
+	for raw, want := range map[string]string{
+		"plain.txt":    "plain.txt",
+		"caf\x82":      "café",
+		"\xc9\xcd\xbb": "╔═╗",
+		"\xe1\xff":     "ß ",
+	} {
+		if got := DecodeCP437(raw); got != want {
+			t.Errorf("DecodeCP437(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestDecodeNamesCP437Fixture(t *testing.T) {
+	srv := newTestServer(t, cp437Zip(t))
+
+	rzf := openTest(t, srv.URL, WithDecodeNames(nil))
+	want := []string{"café.txt", "ÄLTERE/öl.txt"}
+	if got := rzf.List(); !slices.Equal(got, want) {
+		t.Fatalf("List = %q, want %q", got, want)
+	}
+	for i, name := range want {
+		got, err := rzf.Extract(name)
+		if err != nil || string(got) != rzf.Files()[i].Name {
+			t.Errorf("Extract(%q) = %q, %v", name, got, err)
+		}
+	}
+	if got := rzf.ListDir("ÄLTERE"); !slices.Equal(got, want[1:]) {
+		t.Errorf("ListDir = %q, want %q", got, want[1:])
+	}
+	if !matchPattern("ÄLTERE/*.txt", rzf.DisplayName(rzf.Files()[1])) {
+		t.Error("pattern does not match the decoded name")
+	}
+
+	// Without the option, names are left as stored
+	raw := openTest(t, srv.URL)
+	if got := raw.DisplayName(raw.Files()[0]); got != "caf\x82.txt" {
+		t.Errorf("DisplayName without DecodeNames = %q", got)
+	}
+}
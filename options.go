@@ -0,0 +1,553 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"time"
+)
+
+// Options configures how a RemoteZipFile loads the remote archive
+type Options struct {
+	// MaxEntries caps the number of entries accepted from the central
+	// directory. Archives declaring more entries fail to load, which protects
+	// callers handling untrusted URLs from pathological directories.
+	// Zero (the default) means unlimited.
+	MaxEntries int
+
+	// MaxConnections limits the number of connections to the archive's host,
+	// both active and idle. Concurrent Open/Extract calls beyond the limit
+	// wait for a connection to free up. Zero (the default) keeps up to 10
+	// idle connections and does not limit active ones.
+	MaxConnections int
+
+	// Prefix restricts the loaded entries to names starting with it, e.g.
+	// "images/". Files, List and Open only see the matching entries and the
+	// rest of the directory is released after parsing. Empty keeps everything.
+	Prefix string
+
+	// DecodeNames recovers proper UTF-8 entry names, preferring the Info-ZIP
+	// Unicode Path extra field and otherwise converting names of entries
+	// without the UTF-8 flag from their legacy encoding. The result is
+	// available from DisplayName and is accepted by name lookups such as Open
+	// alongside the raw name.
+	DecodeNames bool
+
+	// NormalizeBackslashes replaces every backslash in entry names with a
+	// forward slash as the central directory is loaded, for archives from
+	// noncompliant (mostly old Windows) tools that use backslashes as path
+	// separators, which the ZIP specification (APPNOTE 4.4.17) forbids:
+	// "All slashes MUST be forward slashes '/'". Directories are then
+	// recreated and patterns match as intended. It is opt-in because a
+	// backslash may legitimately be part of a name, including as the second
+	// byte of a Shift-JIS character; names are rewritten before DecodeNames
+	// decodes them. It does not apply in LowMemory mode.
+	NormalizeBackslashes bool
+
+	// NewestDuplicate makes name lookups (Open, Extract and the other
+	// methods taking a name) pick, among entries sharing the name, the one
+	// with the latest modification time, for archives updated by appending
+	// a new version of a file. By default the first entry in the central
+	// directory is used; see Duplicates.
+	// Entries with equal times keep directory order. It does not apply in
+	// LowMemory mode.
+	NewestDuplicate bool
+
+	// NameDecoder converts a legacy-encoded name to UTF-8 when DecodeNames is
+	// set. Nil means DecodeCP437.
+	NameDecoder func(string) string
+
+	// MaxRetries is how many times a range request is resumed after the
+	// connection drops mid-body ("unexpected EOF"). Each retry requests only
+	// the bytes not yet received. Zero means the default of 3; a negative
+	// value disables retries.
+	MaxRetries int
+
+	// ExpectedSHA256 maps entry names to the hex-encoded SHA-256 digest of
+	// their uncompressed contents. Extract verifies entries listed here and
+	// fails with ErrChecksumMismatch when the digest differs. Entries not in
+	// the map are not checked.
+	ExpectedSHA256 map[string]string
+
+	// Password decrypts entries encrypted with traditional PKWARE
+	// encryption (ZipCrypto). A wrong password is nearly always detected
+	// when the entry is opened, failing with ErrWrongPassword, and otherwise
+	// by the CRC-32 check. Encrypted entries cannot be opened with
+	// OpenReaderAt. Empty means none: encrypted entries fail with
+	// ErrEncrypted, as WinZip AES entries always do.
+	Password string
+
+	// EOCDSearchSize is how many bytes at the end of the archive are fetched
+	// to find the End of Central Directory record. Archives without a comment
+	// need only 22 bytes, so a small window saves bandwidth; if the record is
+	// not found, the maximum window (64KB plus the record) is read once more.
+	// Zero means the default of 64KB.
+	EOCDSearchSize int64
+
+	// Decompressors registers additional compression methods on the archive
+	// reader at load time, e.g. zstd (93) or xz (95). See RegisterDecompressor.
+	Decompressors map[uint16]zip.Decompressor
+
+	// MaxBufferedSize caps how many bytes are held in memory when an archive
+	// has to be read whole, as NewFromReader does. Zero means the default of
+	// 512 MiB.
+	MaxBufferedSize int64
+
+	// MaxDecompressedSize caps the uncompressed size of any single entry.
+	// Reading past it fails with ErrTooLarge, which guards against
+	// decompression bombs. Zero (the default) means unlimited.
+	MaxDecompressedSize int64
+
+	// MaxCompressionRatio caps how many times larger than its compressed
+	// size a compressed entry may decompress to. Entries declaring a higher
+	// ratio are refused and reading one past it fails with ErrTooLarge, so
+	// a decompression bomb is caught even when its header understates the
+	// size. Zero (the default) means unlimited.
+	MaxCompressionRatio float64
+
+	// Strict refuses archives with entries that are symbolic links or whose
+	// names could escape a destination directory (absolute paths, ".."
+	// components, backslashes, drive letters, NUL bytes), failing with
+	// ErrUnsafeEntry. Without LowMemory the whole archive is refused when it
+	// is loaded; in LowMemory mode such entries are refused when opened.
+	Strict bool
+
+	// ChunkSize makes every range request cover whole ChunkSize-aligned
+	// blocks of the archive, serving reads from the fetched blocks. This cuts
+	// the request count on backends that charge per request or have a
+	// minimum read cost, at the price of reading some bytes that are not
+	// needed. Zero (the default) fetches exactly the bytes requested.
+	ChunkSize int64
+
+	// ChunkCacheSize is how many of the most recently used chunks are kept in
+	// memory when ChunkSize is set. Zero means the default of 16.
+	ChunkCacheSize int
+
+	// ContentCacheSize keeps the decompressed contents of the most recently
+	// extracted files in memory, up to this many bytes in total, so that
+	// Extract serves repeated requests for popular files of an immutable
+	// archive without fetching or decompressing them again. Files larger
+	// than the cap are never cached. A Changed call that detects a change
+	// empties the cache. Zero (the default) disables it.
+	ContentCacheSize int64
+
+	// SmallFileThreshold makes archives smaller than this many bytes be
+	// downloaded whole with one request right after their size is known,
+	// and served from memory from then on: for small archives this beats
+	// the several round trips of reading the central directory and each
+	// entry separately. Zero means the default of 1MB; a negative value
+	// always uses range requests.
+	SmallFileThreshold int64
+
+	// GunzipFallback handles URLs serving a gzip-compressed archive
+	// (.zip.gz), which otherwise fail with ErrGzipped: the whole file is
+	// downloaded, decompressed into memory (up to MaxBufferedSize) and
+	// served from there.
+	GunzipFallback bool
+
+	// IdleTimeout aborts a range response whose body delivers no data for
+	// this long. It is reset after every successful read, so a slow but steady
+	// transfer of any size completes while a stalled connection does not hang
+	// forever. A stall counts as a dropped connection for MaxRetries. Zero
+	// means the default of 30 seconds; a negative value disables it.
+	IdleTimeout time.Duration
+
+	// RangeMethod is the HTTP method of range reads, for gateways that only
+	// serve ranges for a particular verb. No request ever carries a body.
+	// Empty means GET.
+	RangeMethod string
+
+	// MetadataMethod is the HTTP method of the request that detects the
+	// archive's size, which must not return a body. Empty means HEAD. GET
+	// skips it in favour of the one-byte range request (sent with
+	// RangeMethod) that is otherwise only the fallback.
+	MetadataMethod string
+
+	// RangeHeader, if set, formats the header of every single-range request
+	// from the first and last byte wanted (inclusive, as in HTTP), returning
+	// the header's name and value. The name is sent with the casing given.
+	// This is an advanced, last-resort escape hatch for noncompliant origins
+	// that expect nonstandard range syntax or header casing; responses must
+	// still be standard 206s with a Content-Range header. Multi-range
+	// requests (see MultiRange) are not affected. Nil means the standard
+	// "Range: bytes=first-last".
+	RangeHeader func(first, last int64) (name, value string)
+
+	// LowMemory skips building the entry list, for archives with millions of
+	// entries of which only a few are needed. Lookups by name (Open, Extract,
+	// ...) then stream the central directory from the server in 64KB range
+	// requests until the entry is found, holding one directory header at a
+	// time, so each lookup costs up to a full directory download instead of
+	// a map-free scan of memory. Files, List and the index-based methods see
+	// no entries, names are matched raw (DecodeNames does not apply), and
+	// ScanNames walks all names.
+	LowMemory bool
+
+	// DeferIndex makes the constructors skip reading the central directory,
+	// so that it can be read under a context with LoadIndexContext. Only the
+	// size is determined up front; lookups fail until the index is loaded.
+	DeferIndex bool
+
+	// MultiRange lets OpenMany fetch files that lie apart with a single
+	// multi-range request ("Range: bytes=a-b, c-d"), whose multipart/byteranges
+	// response holds just the files, instead of one span covering everything
+	// in between. Support is probed with a tiny request on first use; servers
+	// that answer with 200 or a single range are sent a request per file.
+	MultiRange bool
+
+	// RateLimit throttles requests and requested bytes, to be polite to a
+	// shared server. Both metadata and data fetches count. Zero means
+	// unlimited.
+	RateLimit RateLimit
+
+	// MaxRedirects limits how many redirects a request follows. Zero means
+	// Go's default of 10; a negative value follows none. Like
+	// MaxConnections, it only applies to the default client.
+	MaxRedirects int
+
+	// Client is used for all requests instead of the default pooled client.
+	// MaxConnections and MaxRedirects have no effect on it, and Close leaves
+	// it open.
+	Client *http.Client
+
+	// Header is added to every request, e.g. for authentication. A Host
+	// field replaces the URL's host in the Host header only, to reach a
+	// virtual host through an address such as http://[::1]:8080/. Like any
+	// header, an Authorization field is dropped by net/http on redirects to
+	// another host.
+	Header http.Header
+
+	// Logger receives diagnostics: every request at Debug level, and
+	// retries and fallbacks (HEAD rejected, wrong Content-Length, ...) at
+	// Info or Warn. Nothing is logged when it is nil.
+	Logger *slog.Logger
+}
+
+// defaultMaxRetries is the retry budget used when Options.MaxRetries is zero
+const defaultMaxRetries = 3
+
+// defaultEOCDSearchSize is the tail read used when Options.EOCDSearchSize
+// is zero
+const defaultEOCDSearchSize = 65536
+
+// maxEOCDSearchSize covers the largest possible archive comment (65535 bytes)
+// plus the 22-byte EOCD record
+const maxEOCDSearchSize = 65535 + 22
+
+// defaultIdleTimeout is the stall limit used when Options.IdleTimeout is
+// zero
+const defaultIdleTimeout = 30 * time.Second
+
+// defaultSmallFileThreshold is the size below which archives are buffered
+// whole when Options.SmallFileThreshold is zero
+const defaultSmallFileThreshold = 1 << 20
+
+// defaultChunkCacheSize is the number of chunks cached when
+// Options.ChunkCacheSize is zero
+const defaultChunkCacheSize = 16
+
+// defaultMaxBufferedSize is the buffering cap used when
+// Options.MaxBufferedSize is zero
+const defaultMaxBufferedSize = 512 << 20
+
+// rangeMethod returns the method for range reads
+func (o Options) rangeMethod() string {
+	if o.RangeMethod == "" {
+		return http.MethodGet
+	}
+	return o.RangeMethod
+}
+
+// setRange sets the header asking for bytes first through last on req,
+// formatted by RangeHeader if set
+func (o Options) setRange(req *http.Request, first, last int64) {
+	if o.RangeHeader == nil {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+		return
+	}
+	name, value := o.RangeHeader(first, last)
+	req.Header[name] = []string{value}
+}
+
+// metadataMethod returns the method for size detection
+func (o Options) metadataMethod() string {
+	if o.MetadataMethod == "" {
+		return http.MethodHead
+	}
+	return o.MetadataMethod
+}
+
+// logger returns Logger, or one that discards everything
+func (o Options) logger() *slog.Logger {
+	if o.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return o.Logger
+}
+
+// Option configures a RemoteZipFile created by NewRemoteZipFile
+type Option func(*Options)
+
+// buildOptions applies opts, in order, to the zero Options
+func buildOptions(opts []Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithOptions replaces the whole configuration with o. Options that follow
+// it adjust a copy of o, so a shared set of defaults can be refined per call.
+func WithOptions(o Options) Option {
+	return func(opts *Options) {
+		*opts = o
+		opts.Header = o.Header.Clone()
+		opts.ExpectedSHA256 = maps.Clone(o.ExpectedSHA256)
+		opts.Decompressors = maps.Clone(o.Decompressors)
+	}
+}
+
+// WithClient sets Options.Client
+func WithClient(client *http.Client) Option {
+	return func(o *Options) {
+		o.Client = client
+	}
+}
+
+// WithLogger sets Options.Logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithHeader adds a header sent with every request
+func WithHeader(key, value string) Option {
+	return func(o *Options) {
+		if o.Header == nil {
+			o.Header = http.Header{}
+		}
+		o.Header.Add(key, value)
+	}
+}
+
+// WithBasicAuth sends HTTP basic authentication credentials with every request
+func WithBasicAuth(username, password string) Option {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return func(o *Options) {
+		if o.Header == nil {
+			o.Header = http.Header{}
+		}
+		o.Header.Set("Authorization", "Basic "+credentials)
+	}
+}
+
+// WithPassword sets Options.Password
+func WithPassword(password string) Option {
+	return func(o *Options) {
+		o.Password = password
+	}
+}
+
+// WithRetry sets Options.MaxRetries
+func WithRetry(maxRetries int) Option {
+	return func(o *Options) {
+		o.MaxRetries = maxRetries
+	}
+}
+
+// WithMaxEntries sets Options.MaxEntries
+func WithMaxEntries(n int) Option {
+	return func(o *Options) {
+		o.MaxEntries = n
+	}
+}
+
+// WithMaxConnections sets Options.MaxConnections
+func WithMaxConnections(n int) Option {
+	return func(o *Options) {
+		o.MaxConnections = n
+	}
+}
+
+// WithMaxDecompressedSize sets Options.MaxDecompressedSize
+func WithMaxDecompressedSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxDecompressedSize = n
+	}
+}
+
+// WithMaxCompressionRatio sets Options.MaxCompressionRatio
+func WithMaxCompressionRatio(ratio float64) Option {
+	return func(o *Options) {
+		o.MaxCompressionRatio = ratio
+	}
+}
+
+// WithStrict sets Options.Strict
+func WithStrict() Option {
+	return func(o *Options) {
+		o.Strict = true
+	}
+}
+
+// WithMaxRedirects sets Options.MaxRedirects
+func WithMaxRedirects(n int) Option {
+	return func(o *Options) {
+		o.MaxRedirects = n
+	}
+}
+
+// WithMaxBufferedSize sets Options.MaxBufferedSize
+func WithMaxBufferedSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxBufferedSize = n
+	}
+}
+
+// WithPrefix sets Options.Prefix
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+// WithDecodeNames enables Options.DecodeNames, using decoder for legacy
+// names (nil for CP437)
+func WithDecodeNames(decoder func(string) string) Option {
+	return func(o *Options) {
+		o.DecodeNames = true
+		o.NameDecoder = decoder
+	}
+}
+
+// WithExpectedSHA256 adds an expected digest to Options.ExpectedSHA256
+func WithExpectedSHA256(name, digest string) Option {
+	return func(o *Options) {
+		if o.ExpectedSHA256 == nil {
+			o.ExpectedSHA256 = map[string]string{}
+		}
+		o.ExpectedSHA256[name] = digest
+	}
+}
+
+// WithGunzipFallback sets Options.GunzipFallback
+func WithGunzipFallback() Option {
+	return func(o *Options) {
+		o.GunzipFallback = true
+	}
+}
+
+// WithNormalizeBackslashes sets Options.NormalizeBackslashes
+func WithNormalizeBackslashes() Option {
+	return func(o *Options) {
+		o.NormalizeBackslashes = true
+	}
+}
+
+// WithNewestDuplicate sets Options.NewestDuplicate
+func WithNewestDuplicate() Option {
+	return func(o *Options) {
+		o.NewestDuplicate = true
+	}
+}
+
+// WithSmallFileThreshold sets Options.SmallFileThreshold
+func WithSmallFileThreshold(size int64) Option {
+	return func(o *Options) {
+		o.SmallFileThreshold = size
+	}
+}
+
+// WithIdleTimeout sets Options.IdleTimeout
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.IdleTimeout = d
+	}
+}
+
+// WithRangeHeader sets Options.RangeHeader. It is a last resort for
+// servers that do not understand standard range requests.
+func WithRangeHeader(format func(first, last int64) (name, value string)) Option {
+	return func(o *Options) {
+		o.RangeHeader = format
+	}
+}
+
+// WithRangeMethod sets Options.RangeMethod
+func WithRangeMethod(method string) Option {
+	return func(o *Options) {
+		o.RangeMethod = method
+	}
+}
+
+// WithMetadataMethod sets Options.MetadataMethod
+func WithMetadataMethod(method string) Option {
+	return func(o *Options) {
+		o.MetadataMethod = method
+	}
+}
+
+// WithLowMemory enables Options.LowMemory
+func WithLowMemory() Option {
+	return func(o *Options) {
+		o.LowMemory = true
+	}
+}
+
+// WithDeferredIndex enables Options.DeferIndex
+func WithDeferredIndex() Option {
+	return func(o *Options) {
+		o.DeferIndex = true
+	}
+}
+
+// WithMultiRange enables Options.MultiRange
+func WithMultiRange() Option {
+	return func(o *Options) {
+		o.MultiRange = true
+	}
+}
+
+// WithRateLimit sets Options.RateLimit
+func WithRateLimit(requestsPerSecond, bytesPerSecond float64) Option {
+	return func(o *Options) {
+		o.RateLimit = RateLimit{RequestsPerSecond: requestsPerSecond, BytesPerSecond: bytesPerSecond}
+	}
+}
+
+// WithEOCDSearchSize sets Options.EOCDSearchSize
+func WithEOCDSearchSize(n int64) Option {
+	return func(o *Options) {
+		o.EOCDSearchSize = n
+	}
+}
+
+// WithChunkSize sets Options.ChunkSize and Options.ChunkCacheSize
+func WithChunkSize(size int64, cacheSize int) Option {
+	return func(o *Options) {
+		o.ChunkSize = size
+		o.ChunkCacheSize = cacheSize
+	}
+}
+
+// WithContentCache sets Options.ContentCacheSize
+func WithContentCache(maxBytes int64) Option {
+	return func(o *Options) {
+		o.ContentCacheSize = maxBytes
+	}
+}
+
+// WithDecompressor adds a decompressor to Options.Decompressors
+func WithDecompressor(method uint16, dcomp zip.Decompressor) Option {
+	return func(o *Options) {
+		if o.Decompressors == nil {
+			o.Decompressors = map[uint16]zip.Decompressor{}
+		}
+		o.Decompressors[method] = dcomp
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// errNoTerminal is returned when a password is needed but there is no
+// terminal to ask for it on
+var errNoTerminal = errors.New("encrypted files need a password, but there is no terminal to prompt on; pass it with --password-stdin")
+
+// readPasswordLine reads one line from r for --password-stdin, without its
+// line ending
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if line == "" {
+		return "", errors.New("no password given")
+	}
+	return line, nil
+}
+
+// promptPassword asks for a password on the controlling terminal, which
+// need not be stdin, without echoing it
+func promptPassword() (string, error) {
+	tty, err := os.OpenFile(terminalName(), os.O_RDWR, 0)
+	if err != nil {
+		return "", errNoTerminal
+	}
+	defer tty.Close()
+	if !term.IsTerminal(int(tty.Fd())) {
+		return "", errNoTerminal
+	}
+
+	// CONIN$ is input only, so Windows shows the prompt on stderr
+	var prompt io.Writer = tty
+	if runtime.GOOS == "windows" {
+		prompt = os.Stderr
+	}
+	fmt.Fprint(prompt, "Password: ")
+	password, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return readPasswordLine(bytes.NewReader(password))
+}
+
+// terminalName names the device of the terminal or console, which remains
+// readable when stdin is redirected
+func terminalName() string {
+	if runtime.GOOS == "windows" {
+		return "CONIN$"
+	}
+	return "/dev/tty"
+}
+
+// needsPassword reports whether any of files selected by includes and
+// excludes is encrypted with ZipCrypto, which a password decrypts
+func needsPassword(rzf *RemoteZipFile, files []*zip.File, includes, excludes []string) bool {
+	for _, f := range files {
+		if isZipCrypto(f) && !f.FileInfo().IsDir() && selected(rzf.DisplayName(f), includes, excludes) {
+			return true
+		}
+	}
+	return false
+}
+
+// isZipCrypto reports whether f is encrypted with traditional PKWARE
+// encryption rather than WinZip AES
+func isZipCrypto(f *zip.File) bool {
+	return f.Flags&0x1 != 0 && f.Method != aesMethod
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"archive/zip"
+	"strings"
+	"testing"
+)
+
+func TestReadPasswordLine(t *testing.T) {
+	for input, want := range map[string]string{
+		"hunter2\n":        "hunter2",
+		"hunter2\r\n":      "hunter2",
+		"hunter2":          "hunter2",
+		" two words \nx\n": " two words ",
+	} {
+		got, err := readPasswordLine(strings.NewReader(input))
+		if err != nil || got != want {
+			t.Errorf("readPasswordLine(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "\n"} {
+		if _, err := readPasswordLine(strings.NewReader(input)); err == nil {
+			t.Errorf("readPasswordLine(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestNeedsPassword(t *testing.T) {
+	srv := newTestServer(t, encryptedZip(t, "secret/a.txt", "secret", zip.Deflate, "hunter2"))
+	rzf := openTest(t, srv.URL)
+
+	if !needsPassword(rzf, rzf.Files(), nil, nil) {
+		t.Error("an encrypted file is selected, but no password is needed")
+	}
+	if needsPassword(rzf, rzf.Files(), []string{"other/**"}, nil) || needsPassword(rzf, rzf.Files(), nil, []string{"secret/**"}) {
+		t.Error("no encrypted file is selected, but a password is needed")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ProbeResult describes what a server reported for a single HEAD request
+type ProbeResult struct {
+	// URL is the final URL after following redirects
+	URL string
+
+	StatusCode    int
+	AcceptRanges  bool
+	ContentLength int64 // -1 when the server did not send one
+}
+
+// Err returns nil if the probed URL looks usable by NewRemoteZipFile, or an
+// error describing the first problem found
+func (p ProbeResult) Err() error {
+	switch {
+	case p.StatusCode != http.StatusOK:
+		return &HTTPStatusError{StatusCode: p.StatusCode}
+	case !p.AcceptRanges:
+		return ErrRangeUnsupported
+	case p.ContentLength <= 0:
+		return errors.New("server did not report a Content-Length")
+	}
+	return nil
+}
+
+// Probe issues a single HEAD request to url and reports whether the server
+// supports what NewRemoteZipFile needs, without reading the central
+// directory. A nil error only means the request completed; check the
+// result's Err method for usability. Servers that reject HEAD may still work
+// with NewRemoteZipFile, which falls back to a ranged GET. Options such as
+// WithHeader, WithBasicAuth, WithClient and WithMetadataMethod (to send
+// something other than HEAD) apply to the request.
+func Probe(url string, options ...Option) (ProbeResult, error) {
+	opts := buildOptions(options)
+	client := opts.Client
+	if client == nil {
+		client = newHTTPClient(opts)
+		defer client.CloseIdleConnections()
+	}
+
+	req, err := newRequest(opts.metadataMethod(), url, opts.Header)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+	resp.Body.Close()
+
+	return ProbeResult{
+		URL:           resp.Request.URL.String(),
+		StatusCode:    resp.StatusCode,
+		AcceptRanges:  resp.Header.Get("Accept-Ranges") == "bytes",
+		ContentLength: resp.ContentLength,
+	}, nil
+}
+
+// Warmup makes a small request to the archive's URL, a metadata request
+// (see Options.MetadataMethod) or a one-byte range if that is GET, and
+// drains it so that the connection is parked in the client's idle pool. The
+// next fetch then skips the TCP and TLS handshakes. This suits interactive
+// use, where an archive opened with DeferIndex, or one left idle longer
+// than the transport's IdleConnTimeout while waiting for a selection, would
+// otherwise pay for a new connection on the first fetch. Whether the
+// connection is kept is up to the transport's idle pool settings; with a
+// custom client that disables keep-alives, Warmup only checks that the
+// server responds. It does nothing for archives not read over HTTP.
+func (rzf *RemoteZipFile) Warmup(ctx context.Context) error {
+	if rzf.state().local != nil || !rzf.overHTTP() {
+		return nil
+	}
+
+	method := rzf.opts.metadataMethod()
+	req, err := newRequest(method, rzf.URL, rzf.opts.Header)
+	if err != nil {
+		return err
+	}
+	if method == http.MethodGet {
+		rzf.opts.setRange(req, 0, 0)
+	}
+
+	resp, err := rzf.do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("warmup request failed: %w", err)
+	}
+	// A connection is only reused once its response is read to the end.
+	// A server ignoring the range would send the whole archive instead, and
+	// losing the connection is cheaper than that.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return &HTTPStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit throttles the requests a RemoteZipFile sends to its server. Zero
+// fields are unlimited.
+type RateLimit struct {
+	// RequestsPerSecond caps the rate of HTTP requests of any kind
+	RequestsPerSecond float64
+
+	// BytesPerSecond caps the rate at which range requests ask for bytes.
+	// A single request may exceed one second's budget; the requests after it
+	// then wait for the debt to be paid off.
+	BytesPerSecond float64
+}
+
+// tokenBucket is a token bucket that lets callers go into debt, so a single
+// request larger than the burst is delayed rather than refused. It is safe
+// for concurrent use.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket refilled at rate tokens per second, holding
+// up to one second's worth (at least one token), or nil if rate is not
+// positive
+func newTokenBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	burst := max(rate, 1)
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes n tokens, blocking until the bucket is out of debt or ctx is
+// done. On cancellation the tokens are returned. A nil bucket never blocks.
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= n
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens += n
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -3,127 +3,589 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // RemoteZipFile represents a ZIP file accessed via HTTP
 type RemoteZipFile struct {
 	URL        string
 	httpClient *http.Client
-	size       int64
-	files      []*zip.File
-	reader     *zip.Reader
+	opts       Options
+	fetcher    Fetcher // fetches ranges unless local is set
+	stats      *stats
+
+	// requestLimit and byteLimit enforce Options.RateLimit; nil is unlimited
+	requestLimit, byteLimit *tokenBucket
+
+	// mu guards archiveState, which Reopen replaces. Readers take it for
+	// reading through state; it is held for writing only while Reopen
+	// swaps a new state in.
+	mu sync.RWMutex
+	archiveState
+
+	// sniffed caches the results of ContentType
+	sniffed sniffCache
+
+	// spans are the buffers of OpenMany that serve reads before the server
+	spans spanSet
+
+	// multiRange records whether the server answers multi-range requests
+	multiRange multiRangeSupport
+
+	// decompressors registered through RegisterDecompressor
+	decompressors map[uint16]zip.Decompressor
+
+	// owner is the RemoteZipFile whose new state this one is loading, when
+	// created by loader
+	owner *RemoteZipFile
+}
+
+// NewRemoteZipFile creates a new RemoteZipFile instance. Without options it
+// uses the defaults described on Options.
+func NewRemoteZipFile(url string, opts ...Option) (*RemoteZipFile, error) {
+	return NewRemoteZipFileWithOptions(url, buildOptions(opts))
+}
+
+// NewRemoteZipFileWithOptions creates a new RemoteZipFile instance using opts
+func NewRemoteZipFileWithOptions(url string, opts Options) (*RemoteZipFile, error) {
+	rzf := &RemoteZipFile{
+		URL:        url,
+		opts:       opts,
+		httpClient: opts.Client,
+		stats:      new(stats),
+	}
+	rzf.fetcher = httpFetcher{rzf}
+	if rzf.httpClient == nil {
+		rzf.httpClient = newHTTPClient(opts)
+	}
+	rzf.requestLimit = newTokenBucket(opts.RateLimit.RequestsPerSecond)
+	rzf.byteLimit = newTokenBucket(opts.RateLimit.BytesPerSecond)
+	if opts.ChunkSize > 0 {
+		rzf.chunks = newChunkCache(opts.ChunkCacheSize)
+	}
+	if opts.ContentCacheSize > 0 {
+		rzf.contents = newContentCache(opts.ContentCacheSize)
+	}
+
+	// Get the file size
+	if err := rzf.loadSize(context.Background()); err != nil {
+		return nil, err
+	}
+	rzf.bufferSmallArchive(context.Background())
+
+	// Read the central directory
+	if !opts.DeferIndex {
+		if err := rzf.LoadIndexContext(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return rzf, nil
 }
 
-// NewRemoteZipFile creates a new RemoteZipFile instance
-func NewRemoteZipFile(url string) (*RemoteZipFile, error) {
-	// Create HTTP client with connection pooling and keep-alive
+// LoadIndexContext reads the central directory, or reads it again if it was
+// already loaded. It is needed after construction with Options.DeferIndex,
+// and lets the several range requests of a large directory be abandoned: once
+// ctx is done, the request in flight is cancelled and ctx.Err() is returned.
+// Entries are read without ctx afterwards. It must not be called
+// concurrently with other methods.
+func (rzf *RemoteZipFile) LoadIndexContext(ctx context.Context) error {
+	err := rzf.readCentralDirectory(ctx)
+	if errors.Is(err, ErrGzipped) && rzf.opts.GunzipFallback {
+		rzf.opts.logger().Warn("archive is gzip-compressed, downloading it whole to decompress", "size", rzf.size)
+		if err = rzf.gunzipArchive(ctx); err == nil {
+			err = rzf.readCentralDirectory(ctx)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to read central directory: %w", err)
+	}
+	rzf.indexed = true
+	return nil
+}
+
+// newHTTPClient creates an HTTP client with connection pooling and keep-alive
+func newHTTPClient(opts Options) *http.Client {
+	maxIdle := 10
+	if opts.MaxConnections > 0 {
+		maxIdle = opts.MaxConnections
+	}
+	var checkRedirect func(*http.Request, []*http.Request) error
+	if opts.MaxRedirects != 0 {
+		checkRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > max(opts.MaxRedirects, 0) {
+				return fmt.Errorf("stopped after %d redirects", len(via)-1)
+			}
+			return nil
+		}
+	}
 	transport := &http.Transport{
-		MaxIdleConns:        10,
-		MaxIdleConnsPerHost: 10,
+		MaxIdleConns:        maxIdle,
+		MaxIdleConnsPerHost: maxIdle,
+		MaxConnsPerHost:     opts.MaxConnections,
 		IdleConnTimeout:     90 * time.Second,
 		DisableKeepAlives:   false,
-		DisableCompression:  true, // We handle compression ourselves
+		// Never negotiate Content-Encoding: ranges are applied to the encoded
+		// representation, so gzip over the wire would shift every offset taken
+		// from the central directory. ZIP entries are compressed already.
+		DisableCompression: true,
+		// Bound connecting and waiting for headers only. A total deadline on
+		// the client would also cut off large bodies that are still streaming;
+		// those are bounded by Options.IdleTimeout instead.
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
 	}
-	
+}
+
+// NewFromReader reads a whole archive from r (e.g. stdin) into memory and
+// serves all reads from there, bypassing HTTP. Since this is a full download,
+// archives larger than Options.MaxBufferedSize are rejected.
+func NewFromReader(r io.Reader, options ...Option) (*RemoteZipFile, error) {
+	opts := buildOptions(options)
+
+	limit := opts.MaxBufferedSize
+	if limit <= 0 {
+		limit = defaultMaxBufferedSize
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("archive exceeds the %d byte buffer limit", limit)
+	}
+
+	return NewFromReaderAt(bytes.NewReader(data), int64(len(data)), options...)
+}
+
+// NewFromReaderAt reads an archive of the given size from r, e.g. an open or
+// memory-mapped file or a cloud SDK's ReaderAt, bypassing HTTP entirely. Only
+// the central directory is read up front; entries are read from r on demand.
+func NewFromReaderAt(r io.ReaderAt, size int64, options ...Option) (*RemoteZipFile, error) {
 	rzf := &RemoteZipFile{
-		URL: url,
-		httpClient: &http.Client{
-			Transport: transport,
-			Timeout:   30 * time.Second,
-		},
+		opts:  buildOptions(options),
+		stats: new(stats),
+	}
+	rzf.local, rzf.size = r, size
+	if rzf.size <= 0 {
+		return nil, fmt.Errorf("could not determine file size")
+	}
+	if rzf.opts.ContentCacheSize > 0 {
+		rzf.contents = newContentCache(rzf.opts.ContentCacheSize)
 	}
 
-	// Get the file size
-	resp, err := rzf.httpClient.Head(url)
+	if !rzf.opts.DeferIndex {
+		if err := rzf.LoadIndexContext(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return rzf, nil
+}
+
+// detectSize determines the archive size and confirms range support. It
+// prefers a HEAD request and falls back to a ranged GET for servers that
+// reject HEAD or omit Content-Length/Accept-Ranges from it.
+func (rzf *RemoteZipFile) detectSize(ctx context.Context) (int64, error) {
+	// A plain GET would download the whole archive
+	if method := rzf.opts.metadataMethod(); method != http.MethodGet {
+		req, err := newRequest(method, rzf.URL, rzf.opts.Header)
+		if err != nil {
+			return 0, err
+		}
+
+		resp, err := rzf.do(req.WithContext(ctx))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && resp.Header.Get("Accept-Ranges") == "bytes" && resp.ContentLength > 0 {
+				rzf.contentType = resp.Header.Get("Content-Type")
+				rzf.etag = resp.Header.Get("ETag")
+				rzf.lastModified = resp.Header.Get("Last-Modified")
+				return resp.ContentLength, nil
+			}
+		}
+		rzf.opts.logger().Info("size not determined by metadata request, probing with a range request", "method", method)
+	}
+
+	return rzf.probeSize(ctx)
+}
+
+// bufferSmallArchive downloads the whole archive into local if it is below
+// Options.SmallFileThreshold. Should that fail, e.g. because the reported
+// size is wrong, range requests are used as usual.
+func (rzf *RemoteZipFile) bufferSmallArchive(ctx context.Context) {
+	threshold := rzf.opts.SmallFileThreshold
+	if threshold == 0 {
+		threshold = defaultSmallFileThreshold
+	}
+	if rzf.size >= threshold {
+		return
+	}
+
+	data, err := rzf.fetch(ctx, 0, rzf.size)
+	if err != nil {
+		rzf.opts.logger().Info("could not buffer small archive, using range requests", "size", rzf.size, "error", err)
+		return
+	}
+	rzf.local = bytes.NewReader(data)
+	rzf.buffered = true
+}
+
+// probeSize requests the first byte (with RangeMethod, GET by default) and
+// reads the total size from the Content-Range header of the 206 response
+func (rzf *RemoteZipFile) probeSize(ctx context.Context) (int64, error) {
+	req, err := newRequest(rzf.opts.rangeMethod(), rzf.URL, rzf.opts.Header)
+	if err != nil {
+		return 0, err
+	}
+	rzf.opts.setRange(req, 0, 0)
+	req = req.WithContext(ctx)
+
+	resp, err := rzf.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return 0, fmt.Errorf("failed to get file info: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return 0, ErrRangeUnsupported
+	default:
+		return 0, &HTTPStatusError{StatusCode: resp.StatusCode}
 	}
 
-	// Check if server supports range requests
-	if resp.Header.Get("Accept-Ranges") != "bytes" {
-		return nil, fmt.Errorf("server does not support range requests")
+	_, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil || total <= 0 {
+		return 0, fmt.Errorf("could not determine file size")
 	}
+	rzf.contentType = resp.Header.Get("Content-Type")
+	rzf.etag = resp.Header.Get("ETag")
+	rzf.lastModified = resp.Header.Get("Last-Modified")
+	return total, nil
+}
 
-	rzf.size = resp.ContentLength
-	if rzf.size <= 0 {
-		return nil, fmt.Errorf("could not determine file size")
+// newRequest creates a bodiless request carrying the configured headers.
+// net/http ignores a Host header field and sends the URL's host, brackets
+// and port included for IPv6 literals, so a configured Host is moved to
+// req.Host, which is how a virtual host is reached through an address.
+func newRequest(method, url string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
 	}
+	return req, nil
+}
 
-	// Read the central directory
-	if err := rzf.readCentralDirectory(); err != nil {
-		return nil, fmt.Errorf("failed to read central directory: %w", err)
+// parseContentRange parses a "bytes first-last/total" Content-Range header.
+// total is -1 when the server reports it as unknown ("*").
+func parseContentRange(header string) (first, last, total int64, err error) {
+	malformed := fmt.Errorf("malformed Content-Range %q", header)
+
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, 0, malformed
+	}
+	rng, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, malformed
+	}
+	if _, err := fmt.Sscanf(rng, "%d-%d", &first, &last); err != nil {
+		return 0, 0, 0, malformed
 	}
 
-	return rzf, nil
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, 0, malformed
+		}
+	}
+	return first, last, total, nil
 }
 
-// Close closes the HTTP client and cleans up resources
+// Close closes the HTTP client and cleans up resources. A client supplied
+// through Options.Client is left alone.
 func (rzf *RemoteZipFile) Close() {
-	if rzf.httpClient != nil && rzf.httpClient.Transport != nil {
+	if rzf.opts.Client == nil && rzf.httpClient != nil && rzf.httpClient.Transport != nil {
 		if transport, ok := rzf.httpClient.Transport.(*http.Transport); ok {
 			transport.CloseIdleConnections()
 		}
 	}
 }
 
-// getRange retrieves a specific byte range from the remote file
+// getRange retrieves a specific byte range from the remote file, through
+// the chunk cache when ChunkSize is set
 func (rzf *RemoteZipFile) getRange(start, end int64) ([]byte, error) {
-	req, err := http.NewRequest("GET", rzf.URL, nil)
+	return rzf.getRangeContext(context.Background(), start, end)
+}
+
+// getRangeContext is getRange, giving up with ctx.Err() once ctx is done
+func (rzf *RemoteZipFile) getRangeContext(ctx context.Context, start, end int64) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if data, ok := rzf.spans.get(start, end); ok {
+		return data, nil
+	}
+
+	st := rzf.state()
+	if st.local != nil {
+		buf := make([]byte, end-start)
+		n, err := st.local.ReadAt(buf, start)
+		if err == io.EOF && n == len(buf) {
+			err = nil
+		}
+		return buf[:n], err
+	}
+
+	if st.chunks != nil {
+		return rzf.getChunkedRange(ctx, st.chunks, st.size, start, end)
+	}
+	return rzf.fetch(ctx, start, end)
+}
+
+// fetchRangeRetry fetches a byte range from the server. If the connection
+// drops mid-body, the remainder is requested again on a new connection, up
+// to the MaxRetries budget.
+func (rzf *RemoteZipFile) fetchRangeRetry(ctx context.Context, start, end int64) ([]byte, error) {
+	retries := rzf.opts.MaxRetries
+	if retries == 0 {
+		retries = defaultMaxRetries
+	}
+
+	var buf []byte
+	for {
+		data, err := rzf.fetchRange(ctx, start+int64(len(buf)), end)
+		buf = append(buf, data...)
+		if err == nil {
+			return buf, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) || retries <= 0 {
+			return nil, err
+		}
+		retries--
+		rzf.opts.logger().Warn("resuming interrupted range request",
+			"start", start+int64(len(buf)), "end", end-1, "error", err, "retries", retries)
+	}
+}
+
+// fetchRange issues a single range request. On a body read error it returns
+// the bytes received so far along with the error.
+func (rzf *RemoteZipFile) fetchRange(ctx context.Context, start, end int64) ([]byte, error) {
+	req, err := newRequest(rzf.opts.rangeMethod(), rzf.URL, rzf.opts.Header)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	rzf.opts.setRange(req, start, end-1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	if err := rzf.byteLimit.wait(ctx, float64(end-start)); err != nil {
+		return nil, err
+	}
 
-	resp, err := rzf.httpClient.Do(req)
+	resp, err := rzf.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode}
 	}
 
-	return io.ReadAll(resp.Body)
-}
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" && ce != "identity" {
+		return nil, fmt.Errorf("server applied Content-Encoding %q to a range response", ce)
+	}
 
-// readCentralDirectory reads the ZIP central directory from the end of the file
-func (rzf *RemoteZipFile) readCentralDirectory() error {
-	// ZIP files have the End of Central Directory (EOCD) record at the end
-	// We'll read the last 64KB to be safe (accounts for comments)
-	searchSize := int64(65536)
-	if searchSize > rzf.size {
-		searchSize = rzf.size
+	// Check that the response covers what was asked for. Servers and proxies
+	// may return a different window than requested; bytes before start are
+	// skipped and bytes past end dropped, but a window that does not contain
+	// start would silently corrupt everything parsed from it. Nothing here
+	// relies on Content-Length, which chunked responses do not have: the
+	// body is read until EOF, up to what Content-Range announced.
+	var skip int64
+	want := end - start
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The whole file, which only lines up if the range starts at 0
+		if start != 0 {
+			return nil, fmt.Errorf("%w: server ignored the Range header", ErrRangeUnsupported)
+		}
+	case http.StatusPartialContent:
+		first, last, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		// The total after the slash must match the size we saw at
+		// construction, otherwise offsets from the central directory are stale
+		if size := rzf.state().size; total >= 0 && total != size {
+			return nil, fmt.Errorf("%w: size is now %d, was %d", ErrFileChanged, total, size)
+		}
+		if first > start || last < start {
+			return nil, fmt.Errorf("server returned bytes %d-%d for requested range %d-%d", first, last, start, end-1)
+		}
+		skip = start - first
+		want = min(end, last+1) - start
+		if first != start || last != end-1 {
+			rzf.opts.logger().Debug("server returned a different range than requested",
+				"requested", fmt.Sprintf("%d-%d", start, end-1), "returned", fmt.Sprintf("%d-%d", first, last))
+		}
 	}
 
-	// Read the end of the file
-	endData, err := rzf.getRange(rzf.size-searchSize, rzf.size)
+	timeout := rzf.opts.IdleTimeout
+	if timeout == 0 {
+		timeout = defaultIdleTimeout
+	}
+	var body io.Reader = resp.Body
+	if timeout > 0 {
+		idle := newIdleTimeoutReader(resp.Body, timeout, cancel)
+		defer idle.stop()
+		body = idle
+	}
+
+	skipped, err := io.CopyN(io.Discard, body, skip)
+	rzf.stats.bytesFetched.Add(skipped)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to skip to requested range: %w", err)
 	}
+	data, err := io.ReadAll(io.LimitReader(body, want))
+	rzf.stats.bytesFetched.Add(int64(len(data)))
+	// A body ending before its Content-Range, which only a chunked response
+	// can do without net/http noticing, or a shorter window are treated like
+	// a dropped connection, so that fetchRangeRetry requests the rest
+	switch {
+	case err != nil:
+	case int64(len(data)) < want:
+		err = fmt.Errorf("response body ended after %d of the %d bytes in its range: %w", len(data), want, io.ErrUnexpectedEOF)
+	case want < end-start:
+		err = fmt.Errorf("server returned %d of %d requested bytes: %w", len(data), end-start, io.ErrUnexpectedEOF)
+	}
+	return data, err
+}
 
-	// Find the End of Central Directory signature (0x06054b50)
-	eocdSignature := []byte{0x50, 0x4b, 0x05, 0x06}
-	eocdPos := -1
-	for i := len(endData) - 22; i >= 0; i-- {
-		if bytes.Equal(endData[i:i+4], eocdSignature) {
-			eocdPos = i
-			break
+// idleTimeoutReader cancels a response once its body has delivered nothing
+// for timeout, restarting the clock after every read that returns data
+type idleTimeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	ir := &idleTimeoutReader{r: r, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, func() {
+		ir.expired.Store(true)
+		cancel()
+	})
+	return ir
+}
+
+// Read reports a stall as io.ErrUnexpectedEOF, so fetchRangeRetry resumes
+// the range on a new connection like it does for a dropped one
+func (ir *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 && !ir.expired.Load() {
+		ir.timer.Reset(ir.timeout)
+	}
+	if err != nil && err != io.EOF && ir.expired.Load() {
+		err = fmt.Errorf("no data received for %v: %w", ir.timeout, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+func (ir *idleTimeoutReader) stop() {
+	ir.timer.Stop()
+}
+
+// readCentralDirectory reads the ZIP central directory from the end of the
+// file, making every request with ctx
+func (rzf *RemoteZipFile) readCentralDirectory(ctx context.Context) error {
+	// ZIP files have the End of Central Directory (EOCD) record at the end
+	// We'll read the last 64KB by default to be safe (accounts for comments)
+	searchSize := rzf.opts.EOCDSearchSize
+	if searchSize < 0 {
+		return fmt.Errorf("EOCDSearchSize must be positive, got %d", searchSize)
+	}
+	if searchSize == 0 {
+		searchSize = defaultEOCDSearchSize
+	}
+
+	endData, eocdPos, err := rzf.searchEOCD(ctx, searchSize)
+
+	// Content-Length may be wrong, e.g. when a proxy reports the length of a
+	// compressed or chunked representation. Suspect it when the tail read
+	// reports a different total or fails as out of range, or when the EOCD
+	// record (plus comment) does not end exactly at the end of the file. In
+	// that case re-derive the size from a Content-Range probe and retry.
+	var statusErr *HTTPStatusError
+	sizeSuspect := errors.Is(err, ErrFileChanged) ||
+		(errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusRequestedRangeNotSatisfiable) ||
+		(err == nil && (eocdPos < 0 || eocdEnd(endData, eocdPos, rzf.size) != rzf.size))
+	if sizeSuspect && rzf.local == nil && rzf.overHTTP() {
+		rzf.opts.logger().Warn("archive does not end at the reported size, probing with a range request", "size", rzf.size)
+		size, probeErr := rzf.probeSize(ctx)
+		switch {
+		case probeErr != nil && err != nil:
+			return fmt.Errorf("size %d from Content-Length could not be reconciled with the server (%v): %w", rzf.size, probeErr, err)
+		case probeErr == nil && size != rzf.size:
+			rzf.opts.logger().Warn("corrected archive size", "reported", rzf.size, "actual", size)
+			rzf.size = size
+			if rzf.chunks != nil {
+				rzf.chunks.reset()
+			}
+			endData, eocdPos, err = rzf.searchEOCD(ctx, searchSize)
 		}
 	}
+	if err != nil {
+		return err
+	}
 
 	if eocdPos < 0 {
-		return fmt.Errorf("could not find End of Central Directory record")
+		return rzf.missingEOCDError(ctx)
 	}
 
 	// Parse EOCD to find central directory location
@@ -132,67 +594,835 @@ func (rzf *RemoteZipFile) readCentralDirectory() error {
 		return fmt.Errorf("EOCD record too short")
 	}
 
+	// archive/zip ignores the disk fields, and would fail on the first
+	// offset into a missing segment
+	totalEntries := binary.LittleEndian.Uint16(eocd[10:12])
+	rzf.disks = parseDiskInfo(endData, eocdPos)
+	if err := rzf.disks.check(totalEntries); err != nil {
+		return err
+	}
+
+	// Reject oversized directories before zip.NewReader allocates every entry.
+	// A value of 0xFFFF means the real count lives in the ZIP64 record, so
+	// that case is checked after parsing instead.
+	if totalEntries != 0xFFFF {
+		if err := rzf.checkEntryCount(int(totalEntries)); err != nil {
+			return err
+		}
+	}
+
+	baseOffset, err := rzf.findBaseOffset(ctx, endData, eocdPos)
+	if err != nil {
+		return err
+	}
+	rzf.baseOffset = baseOffset
+
+	if rzf.opts.LowMemory {
+		return rzf.locateDirectory(ctx, endData, eocdPos)
+	}
+
 	// Create a custom ReaderAt that can read from remote ranges
-	readerAt := &remoteReaderAt{rzf: rzf}
+	readerAt := &remoteReaderAt{rzf: rzf, ctx: ctx}
 
-	// Parse the ZIP structure
+	// Parse the ZIP structure. The entries keep using readerAt, which must
+	// not stay bound to ctx, nor to a loader once its state is swapped in.
 	zipReader, err := zip.NewReader(readerAt, rzf.size)
+	readerAt.ctx = nil
+	if rzf.owner != nil {
+		readerAt.rzf = rzf.owner
+	}
 	if err != nil {
 		return err
 	}
 
+	if err := rzf.checkEntryCount(len(zipReader.File)); err != nil {
+		return err
+	}
+
+	// The EOCD count is only 16 bits wide, so compare modulo 2^16. A mismatch
+	// means part of the directory never made it into the parsed entries.
+	if totalEntries != 0xFFFF && uint16(len(zipReader.File)) != totalEntries {
+		return fmt.Errorf("central directory is truncated: EOCD declares %d entries, found %d",
+			totalEntries, len(zipReader.File))
+	}
+
+	for _, f := range zipReader.File {
+		if rzf.opts.NormalizeBackslashes {
+			f.Name = strings.ReplaceAll(f.Name, `\`, "/")
+		}
+		if err := rzf.checkStrict(f); err != nil {
+			return err
+		}
+	}
+
+	rzf.entryCount = len(zipReader.File)
+
+	if rzf.opts.Prefix != "" {
+		filtered := []*zip.File{}
+		for _, f := range zipReader.File {
+			if strings.HasPrefix(f.Name, rzf.opts.Prefix) {
+				filtered = append(filtered, f)
+			}
+		}
+		zipReader.File = filtered
+	}
+
+	rzf.registerDecompressors(zipReader)
 	rzf.reader = zipReader
 	rzf.files = zipReader.File
+	rzf.headerOffsets = probeHeaderOffsets(readerAt, rzf.files)
 
 	return nil
 }
 
-// List returns a list of file names in the ZIP archive
+// registerDecompressors registers the default, configured and explicitly
+// registered decompressors on zr
+func (rzf *RemoteZipFile) registerDecompressors(zr *zip.Reader) {
+	// archive/zip only knows store and deflate; zstd is common in archives
+	// from 7-Zip and libzip. Custom decompressors may still override it.
+	zr.RegisterDecompressor(zstd.ZipMethodWinZip, zstd.ZipDecompressor())
+	for method, dcomp := range rzf.opts.Decompressors {
+		zr.RegisterDecompressor(method, dcomp)
+	}
+	for method, dcomp := range rzf.decompressors {
+		zr.RegisterDecompressor(method, dcomp)
+	}
+}
+
+// missingEOCDError explains why no End of Central Directory record was
+// found. Pointing the tool at an HTML page or a tarball is a common mistake,
+// so the first bytes are sniffed and reported along with the Content-Type.
+// The Content-Type alone is not trusted: many servers label ZIP files with a
+// generic or wrong type.
+func (rzf *RemoteZipFile) missingEOCDError(ctx context.Context) error {
+	head, err := rzf.getRangeContext(ctx, 0, min(rzf.size, 512))
+	if err != nil {
+		return fmt.Errorf("could not find End of Central Directory record")
+	}
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return fmt.Errorf("could not find End of Central Directory record: the file starts like a ZIP archive but may be truncated")
+	}
+	if bytes.HasPrefix(head, gzipMagic) {
+		return ErrGzipped
+	}
+
+	got := rzf.contentType
+	if got == "" || strings.HasPrefix(got, "application/octet-stream") {
+		got = http.DetectContentType(head)
+	}
+	return fmt.Errorf("%w (got Content-Type %s)", ErrNotZip, got)
+}
+
+// checkEntryCount enforces the MaxEntries option
+func (rzf *RemoteZipFile) checkEntryCount(n int) error {
+	if rzf.opts.MaxEntries > 0 && n > rzf.opts.MaxEntries {
+		return fmt.Errorf("archive has %d entries, exceeding limit of %d", n, rzf.opts.MaxEntries)
+	}
+	return nil
+}
+
+// RegisterDecompressor registers a decompressor for a compression method
+// the standard library does not handle, so this package need not depend on
+// every compression library. The archive's directory is read when the
+// RemoteZipFile is created, but entries are only decompressed on Open, so it
+// is enough to register before opening entries that use method. To have it
+// in place from load time, use Options.Decompressors instead.
+//
+// Zstandard (method 93) is registered by default. For example, to also
+// accept the deprecated PKWARE method number for it:
+//
+//	rzf.RegisterDecompressor(zstd.ZipMethodPKWare, zstd.ZipDecompressor())
+func (rzf *RemoteZipFile) RegisterDecompressor(method uint16, dcomp zip.Decompressor) {
+	if rzf.decompressors == nil {
+		rzf.decompressors = map[uint16]zip.Decompressor{}
+	}
+	rzf.decompressors[method] = dcomp
+	if reader := rzf.state().reader; reader != nil {
+		reader.RegisterDecompressor(method, dcomp)
+	}
+}
+
+// EntryCount returns the number of entries in the archive, as declared by its
+// End of Central Directory record and verified against the parsed directory
+func (rzf *RemoteZipFile) EntryCount() int {
+	return rzf.state().entryCount
+}
+
+// searchEOCD looks for the End of Central Directory record in the last
+// searchSize bytes of the file. A window smaller than the largest possible
+// comment may miss the record, in which case the maximum window is searched.
+func (rzf *RemoteZipFile) searchEOCD(ctx context.Context, searchSize int64) ([]byte, int, error) {
+	endData, eocdPos, err := rzf.findEOCD(ctx, searchSize)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if eocdPos < 0 && searchSize < maxEOCDSearchSize && searchSize < rzf.size {
+		rzf.opts.logger().Debug("end of central directory not found, searching the maximum window", "searched", searchSize)
+		return rzf.findEOCD(ctx, maxEOCDSearchSize)
+	}
+	return endData, eocdPos, nil
+}
+
+// eocdEnd returns the file offset just past the EOCD record at eocdPos in
+// endData, the last bytes of a file of the given size, including its comment
+func eocdEnd(endData []byte, eocdPos int, size int64) int64 {
+	commentLen := binary.LittleEndian.Uint16(endData[eocdPos+20 : eocdPos+22])
+	return size - int64(len(endData)) + int64(eocdPos) + 22 + int64(commentLen)
+}
+
+// findBaseOffset returns the number of bytes prepended to the ZIP proper, as
+// in self-extracting archives. Directory offsets are relative to the start
+// of the ZIP, so the base is the difference between where the EOCD says the
+// central directory starts and where it actually ends up, just before the
+// EOCD record. Like archive/zip, a non-zero base is only trusted when the
+// directory signature is not already found at the unadjusted offset.
+// archive/zip adds the same base to every entry's header offset, so reads
+// through remoteReaderAt always use absolute file offsets.
+//
+// ZIP64 archives keep their directory offsets in a separate record; for them
+// the base is reported as 0.
+func (rzf *RemoteZipFile) findBaseOffset(ctx context.Context, endData []byte, eocdPos int) (int64, error) {
+	eocd := endData[eocdPos:]
+	dirSize := binary.LittleEndian.Uint32(eocd[12:16])
+	dirOffset := binary.LittleEndian.Uint32(eocd[16:20])
+	if dirSize == 0xFFFFFFFF || dirOffset == 0xFFFFFFFF {
+		return 0, nil
+	}
+	eocdOffset := rzf.size - int64(len(endData)) + int64(eocdPos)
+	base := eocdOffset - int64(dirSize) - int64(dirOffset)
+	if base <= 0 || dirSize == 0 {
+		return max(base, 0), nil
+	}
+
+	sig, err := rzf.getRangeContext(ctx, int64(dirOffset), int64(dirOffset)+4)
+	if err != nil {
+		return 0, err
+	}
+	if bytes.Equal(sig, []byte{0x50, 0x4b, 0x01, 0x02}) {
+		return 0, nil
+	}
+	return base, nil
+}
+
+// findEOCD reads the last searchSize bytes of the file (clamped to the file
+// size) and returns them along with the position of the End of Central
+// Directory signature within them, or -1 if it is not present
+func (rzf *RemoteZipFile) findEOCD(ctx context.Context, searchSize int64) ([]byte, int, error) {
+	if searchSize > rzf.size {
+		searchSize = rzf.size
+	}
+
+	// Read the end of the file
+	endData, err := rzf.getRangeContext(ctx, rzf.size-searchSize, rzf.size)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	// Find the End of Central Directory signature (0x06054b50)
+	eocdSignature := []byte{0x50, 0x4b, 0x05, 0x06}
+	for i := len(endData) - 22; i >= 0; i-- {
+		if bytes.Equal(endData[i:i+4], eocdSignature) {
+			return endData, i, nil
+		}
+	}
+
+	return endData, -1, nil
+}
+
+// BaseOffset returns the number of bytes preceding the ZIP data itself, such
+// as the stub of a self-extracting archive, or 0 for a plain ZIP file
+func (rzf *RemoteZipFile) BaseOffset() int64 {
+	return rzf.state().baseOffset
+}
+
+// List returns a list of file names in the ZIP archive, as DisplayName
+// returns them
 func (rzf *RemoteZipFile) List() []string {
-	names := make([]string, len(rzf.files))
-	for i, f := range rzf.files {
-		names[i] = f.Name
+	files := rzf.state().files
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = rzf.DisplayName(f)
+	}
+	return names
+}
+
+// ListDir returns the direct children of the directory prefix ("" for the
+// archive root), in directory order and without duplicates. Deeper paths are
+// collapsed into their first directory below prefix, which keeps its
+// trailing slash, so the result can be passed back to ListDir to expand it.
+// Names are compared as DisplayName returns them. Only the central directory
+// is consulted; no file data is downloaded.
+func (rzf *RemoteZipFile) ListDir(prefix string) []string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, f := range rzf.state().files {
+		name := rzf.DisplayName(f)
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if i := strings.Index(rest, "/"); i >= 0 {
+			name = prefix + rest[:i+1]
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
 	}
 	return names
 }
 
-// Files returns the list of files in the ZIP archive
+// Files returns the list of files in the ZIP archive. It is empty, not nil,
+// for an archive without entries.
 func (rzf *RemoteZipFile) Files() []*zip.File {
-	return rzf.files
+	return rzf.state().files
+}
+
+// Reader returns the *zip.Reader the archive was parsed with, as an escape
+// hatch to archive/zip features that RemoteZipFile does not wrap, such as
+// the archive Comment or the full File headers. Its reads go through the
+// same range requests, chunk cache and statistics as everything else, and
+// like those are safe for concurrent use. Entries opened through it do skip
+// this package's checks, though: MaxDecompressedSize, ExpectedSHA256, the
+// content cache, decryption and the detection of unsupported entries.
+// Decompressors should still be registered with RegisterDecompressor so
+// that both see them. It is nil in LowMemory mode and before the central
+// directory is loaded, and Reopen replaces it.
+func (rzf *RemoteZipFile) Reader() *zip.Reader {
+	return rzf.state().reader
+}
+
+// SortOrder selects the order of SortedFiles
+type SortOrder int
+
+const (
+	// SortArchive keeps the central directory order
+	SortArchive SortOrder = iota
+	// SortName orders entries by name, byte-wise
+	SortName
+	// SortSize orders entries by uncompressed size, smallest first
+	SortSize
+)
+
+// SortedFiles returns a copy of Files() in the given order, which does not
+// depend on how the archive was built. Entries that compare equal keep their
+// archive order. With dirsFirst, directory entries come before all files, so
+// parent directories can be created before anything is written into them.
+func (rzf *RemoteZipFile) SortedFiles(order SortOrder, dirsFirst bool) []*zip.File {
+	files := slices.Clone(rzf.state().files)
+	slices.SortStableFunc(files, func(a, b *zip.File) int {
+		if dirsFirst {
+			aDir, bDir := a.FileInfo().IsDir(), b.FileInfo().IsDir()
+			if aDir != bDir {
+				if aDir {
+					return -1
+				}
+				return 1
+			}
+		}
+		switch order {
+		case SortName:
+			return strings.Compare(a.Name, b.Name)
+		case SortSize:
+			return cmp.Compare(a.UncompressedSize64, b.UncompressedSize64)
+		}
+		return 0
+	})
+	return files
+}
+
+// Entries calls fn for each file in the ZIP archive, in directory order,
+// with the file's index in Files(). Iteration stops early when fn returns
+// false. Unlike List, nothing is allocated per entry.
+func (rzf *RemoteZipFile) Entries(fn func(i int, f *zip.File) bool) {
+	for i, f := range rzf.state().files {
+		if !fn(i, f) {
+			return
+		}
+	}
 }
 
-// Open opens a file from the ZIP archive and returns a ReadCloser
+// Open opens a file from the ZIP archive and returns a ReadCloser.
+// The returned reader also implements io.Seeker; see fileReader for the
+// cost of seeking in stored versus compressed entries.
 func (rzf *RemoteZipFile) Open(name string) (io.ReadCloser, error) {
-	for _, f := range rzf.files {
-		if f.Name == name {
-			return f.Open()
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return rzf.openFile(f)
+}
+
+// OpenIndex opens the file at index i of Files(). Unlike Open, this reaches
+// every entry even when names are duplicated or not valid UTF-8.
+func (rzf *RemoteZipFile) OpenIndex(i int) (io.ReadCloser, error) {
+	f, err := rzf.fileAt(i)
+	if err != nil {
+		return nil, err
+	}
+	return rzf.openFile(f)
+}
+
+// Duplicates returns, for each name that more than one entry carries, the
+// indices of all of those entries in Files(), in archive order. Open and
+// the other name-based methods reach only the first of them (or the newest,
+// under Options.NewestDuplicate); OpenIndex reaches every one. A name
+// hiding a second entry is also a warning sign in archives from untrusted
+// sources. Names are compared as DisplayName returns them. The map is empty
+// if all names are unique, and in LowMemory mode.
+func (rzf *RemoteZipFile) Duplicates() map[string][]int {
+	indices := map[string][]int{}
+	for i, f := range rzf.state().files {
+		name := rzf.DisplayName(f)
+		indices[name] = append(indices[name], i)
+	}
+	for name, is := range indices {
+		if len(is) < 2 {
+			delete(indices, name)
 		}
 	}
+	return indices
+}
 
-	return nil, fmt.Errorf("file not found: %s", name)
+// FindByPartial returns the entries whose names, as DisplayName returns
+// them, contain substr, in archive order, ignoring case if ignoreCase is
+// set. It suits interactive use, where typing a fragment of a long, deeply
+// nested name beats typing all of it. In LowMemory mode the central
+// directory is streamed to find them, and a failure to read it ends the
+// search with the matches found so far.
+func (rzf *RemoteZipFile) FindByPartial(substr string, ignoreCase bool) []*zip.File {
+	if ignoreCase {
+		substr = strings.ToLower(substr)
+	}
+	var matches []*zip.File
+	rzf.ScanEntries(func(f *zip.File) bool {
+		name := rzf.DisplayName(f)
+		if ignoreCase {
+			name = strings.ToLower(name)
+		}
+		if strings.Contains(name, substr) {
+			matches = append(matches, f)
+		}
+		return true
+	})
+	return matches
+}
+
+// fileAt returns the entry at index i, bounds-checked
+func (rzf *RemoteZipFile) fileAt(i int) (*zip.File, error) {
+	st := rzf.state()
+	if !st.indexed {
+		return nil, errNotIndexed
+	}
+	if i < 0 || i >= len(st.files) {
+		return nil, fmt.Errorf("%w: index %d out of range [0, %d)", ErrNotFound, i, len(st.files))
+	}
+	return st.files[i], nil
 }
 
-// Extract extracts a file to the specified output path
+// findFile looks up an entry by name
+func (rzf *RemoteZipFile) findFile(name string) (*zip.File, error) {
+	st := rzf.state()
+	if !st.indexed {
+		return nil, errNotIndexed
+	}
+	if rzf.opts.LowMemory {
+		return rzf.scanForFile(name)
+	}
+
+	var found *zip.File
+	for _, f := range st.files {
+		if f.Name != name && rzf.DisplayName(f) != name {
+			continue
+		}
+		if !rzf.opts.NewestDuplicate {
+			return f, nil
+		}
+		if found == nil || newerThan(f, found) {
+			found = f
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+
+	if st.entryCount == 0 {
+		return nil, fmt.Errorf("%w: %s (archive is empty)", ErrNotFound, name)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// newerThan reports whether f was modified after g, by the times extraction
+// would apply
+func newerThan(f, g *zip.File) bool {
+	fm, _ := fileTimes(f)
+	gm, _ := fileTimes(g)
+	return fm.After(gm)
+}
+
+// openFile opens f for reading through a seekable fileReader
+func (rzf *RemoteZipFile) openFile(f *zip.File) (*fileReader, error) {
+	if limit := rzf.opts.MaxDecompressedSize; limit > 0 && f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%w: %s is %d bytes, limit is %d", ErrTooLarge, f.Name, f.UncompressedSize64, limit)
+	}
+	if err := rzf.checkCompressionRatio(f); err != nil {
+		return nil, err
+	}
+	if err := rzf.checkStrict(f); err != nil {
+		return nil, err
+	}
+
+	// archive/zip would decompress the ciphertext into garbage or an
+	// obscure checksum error
+	if f.Flags&0x1 != 0 {
+		rc, err := rzf.openEncrypted(f)
+		if err != nil {
+			return nil, err
+		}
+		return &fileReader{rzf: rzf, f: f, rc: rc}, nil
+	}
+
+	rc, err := f.Open()
+	if errors.Is(err, zip.ErrAlgorithm) {
+		return nil, fmt.Errorf("%w %d for %s", ErrUnsupportedMethod, f.Method, f.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fileReader{rzf: rzf, f: f, rc: rc}, nil
+}
+
+// Extract extracts a file to the specified output path.
+// If the ExpectedSHA256 option lists the file, its digest is verified.
+// With ContentCacheSize set, the contents are served from and added to the
+// cache; each call returns a copy that the caller may modify.
 func (rzf *RemoteZipFile) Extract(name string) ([]byte, error) {
-	rc, err := rzf.Open(name)
+	contents := rzf.state().contents
+	if contents != nil {
+		if data, ok := contents.get(name); ok {
+			rzf.stats.contentHits.Add(1)
+			return data, nil
+		}
+		rzf.stats.contentMisses.Add(1)
+	}
+
+	f, err := rzf.findFile(name)
 	if err != nil {
 		return nil, err
 	}
+	data, err := rzf.extractFile(f)
+	if err == nil && contents != nil {
+		contents.put(name, data)
+	}
+	return data, err
+}
+
+// ExtractIndex extracts the file at index i of Files()
+func (rzf *RemoteZipFile) ExtractIndex(i int) ([]byte, error) {
+	f, err := rzf.fileAt(i)
+	if err != nil {
+		return nil, err
+	}
+	return rzf.extractFile(f)
+}
+
+// extractFile reads the whole of f into memory
+func (rzf *RemoteZipFile) extractFile(f *zip.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := rzf.extractFileTo(f, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExtractTo streams the decompressed contents of a file into w and returns
+// the number of bytes written. Unlike Extract, the file is never held in
+// memory as a whole. If the ExpectedSHA256 option lists the file, its digest
+// is verified once all of it has been written.
+func (rzf *RemoteZipFile) ExtractTo(name string, w io.Writer) (int64, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return 0, err
+	}
+	return rzf.extractFileTo(f, w)
+}
+
+// Digest streams the decompressed contents of a file through h, e.g. a
+// sha256.New() for content-addressed storage, and returns the number of
+// bytes hashed. Like ExtractTo, it holds no more than a buffer of the file
+// at a time, and the contents are checked against the stored CRC-32 as
+// they pass. h is written to but not reset, so its sum covers anything
+// written before. On error, h holds a partial digest.
+func (rzf *RemoteZipFile) Digest(name string, h hash.Hash) (int64, error) {
+	return rzf.ExtractTo(name, h)
+}
+
+// extractFileTo copies the contents of f into w, verifying its digest when
+// ExpectedSHA256 lists it
+func (rzf *RemoteZipFile) extractFileTo(f *zip.File, w io.Writer) (int64, error) {
+	rc, err := rzf.openFile(f)
+	if err != nil {
+		return 0, err
+	}
 	defer rc.Close()
 
-	return io.ReadAll(rc)
+	expected, verify := rzf.opts.ExpectedSHA256[f.Name]
+	h := sha256.New()
+	if verify {
+		w = io.MultiWriter(w, h)
+	}
+
+	n, err := io.Copy(w, rc)
+	if err != nil {
+		return n, err
+	}
+
+	if verify {
+		actual := hex.EncodeToString(h.Sum(nil))
+		if !strings.EqualFold(actual, expected) {
+			return n, fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, f.Name, actual, expected)
+		}
+	}
+	return n, nil
+}
+
+// ExtractRange extracts up to length bytes starting at offset within the
+// uncompressed contents of a file. Stored entries are served by a single range
+// request; compressed entries are decompressed and discarded up to offset.
+// The result is shorter than length if the file ends first.
+func (rzf *RemoteZipFile) ExtractRange(name string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(f.UncompressedSize64)
+	if offset > size {
+		return nil, fmt.Errorf("offset %d is beyond the end of %s (%d bytes)", offset, name, size)
+	}
+	if length > size-offset {
+		length = size - offset
+	}
+
+	r, err := rzf.openFile(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// Read into a buffer of the exact size so a stored entry is fetched with
+	// one ReadAt rather than many small reads
+	buf := make([]byte, length)
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
 }
 
-// remoteReaderAt implements io.ReaderAt for remote ZIP file access
+// ReadCompressed returns the compressed data of a file exactly as stored in
+// the archive, fetched with one range request and never decompressed. For
+// stored (method 0) entries this equals the file's contents. Together with
+// the file's header, it lets an entry be copied into another archive without
+// recompressing it (see zip.Writer.CreateRaw). The size is taken from the
+// central directory, so this also works for entries written with a trailing
+// data descriptor (general-purpose bit 3), which is not included. Like the
+// other raw-byte methods, it takes the data offset and sizes from
+// archive/zip, which reads them from the ZIP64 extended information extra
+// field (0x0001) when the 32-bit fields hold 0xFFFFFFFF, so entries beyond
+// 4GB into the archive are located correctly.
+func (rzf *RemoteZipFile) ReadCompressed(name string) ([]byte, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return rzf.readCompressed(f)
+}
+
+// readCompressed returns the compressed data of f
+func (rzf *RemoteZipFile) readCompressed(f *zip.File) ([]byte, error) {
+	offset, size, err := rzf.compressedRange(f)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return []byte{}, nil
+	}
+	return rzf.getRange(offset, offset+size)
+}
+
+// DownloadPlan returns where the compressed data of the file name lies in
+// the archive, [start, start+length), and its compression method, for
+// callers that fetch and decompress entries themselves, e.g. a browser
+// frontend making its own range requests. The range is what ReadCompressed
+// would fetch: the offset comes from the local header, which costs a
+// request (or a chunk cache lookup), and the length from the central
+// directory, so a trailing data descriptor is not included. Encrypted
+// entries are planned like any other, their data still encrypted.
+func (rzf *RemoteZipFile) DownloadPlan(name string) (start, length int64, method uint16, err error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	start, length, err = rzf.compressedRange(f)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return start, length, f.Method, nil
+}
+
+// compressedRange returns the offset and size of f's compressed data,
+// checking that it lies within the archive
+func (rzf *RemoteZipFile) compressedRange(f *zip.File) (offset, size int64, err error) {
+	offset, err = f.DataOffset()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to locate data for %s: %w", f.Name, err)
+	}
+	size = int64(f.CompressedSize64)
+	if offset+size > rzf.state().size {
+		return 0, 0, fmt.Errorf("compressed data of %s extends past the end of the archive", f.Name)
+	}
+	return offset, size, nil
+}
+
+// OpenReaderAt returns random access to a stored (method 0) entry, whose
+// contents lie verbatim in the archive. Each ReadAt is served independently
+// by a range request (or the chunk cache), with no state shared between
+// calls, so many goroutines may read disjoint or overlapping regions of a
+// large entry in parallel. Compressed entries can only be read sequentially
+// and are rejected; use Open for those. No CRC check is made.
+func (rzf *RemoteZipFile) OpenReaderAt(name string) (*io.SectionReader, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.Flags&0x1 != 0 {
+		return nil, fmt.Errorf("%w: %s can only be decrypted sequentially", ErrEncrypted, f.Name)
+	}
+	if f.Method != zip.Store {
+		return nil, fmt.Errorf("%s is compressed (method %d); random access needs a stored entry", f.Name, f.Method)
+	}
+	return rzf.storedSection(f)
+}
+
+// storedSection returns the data of f, a stored entry, in the archive
+func (rzf *RemoteZipFile) storedSection(f *zip.File) (*io.SectionReader, error) {
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate data for %s: %w", f.Name, err)
+	}
+	size := int64(f.UncompressedSize64)
+	if offset+size > rzf.state().size {
+		return nil, fmt.Errorf("data of %s extends past the end of the archive", f.Name)
+	}
+	return io.NewSectionReader(&remoteReaderAt{rzf: rzf}, offset, size), nil
+}
+
+// maxLocalHeaderSize is the size of a local file header with the longest
+// possible name and extra field
+const maxLocalHeaderSize = 30 + 0xFFFF + 0xFFFF
+
+// LocalHeader returns the raw local file header of a file: the fixed 30 bytes
+// followed by the name and extra field as stored in front of the file's data.
+// No data is downloaded or decompressed. Comparing the result with the
+// central directory entry reveals inconsistencies between the two. For
+// entries with a data descriptor (general-purpose bit 3 set), the header's
+// CRC-32 and size fields are normally zero; nothing else in this package
+// reads them.
+func (rzf *RemoteZipFile) LocalHeader(name string) ([]byte, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return rzf.localHeader(f)
+}
+
+// localHeader locates the header that ends where f's data starts. The local
+// extra field may differ from the central one, so the header's length is not
+// known up front: a window sized after the central entry is searched first,
+// and if no header ends exactly at the data, the maximum window once more.
+func (rzf *RemoteZipFile) localHeader(f *zip.File) ([]byte, error) {
+	dataOffset, err := f.DataOffset()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate data for %s: %w", f.Name, err)
+	}
+
+	headerSignature := []byte{0x50, 0x4b, 0x03, 0x04}
+	window := int64(30 + len(f.Name) + len(f.Extra) + 1024)
+	for {
+		window = min(window, dataOffset)
+		data, err := rzf.getRange(dataOffset-window, dataOffset)
+		if err != nil {
+			return nil, err
+		}
+		// Scan backwards so the header closest to the data wins
+		for i := len(data) - 30; i >= 0; i-- {
+			if !bytes.Equal(data[i:i+4], headerSignature) {
+				continue
+			}
+			nameLen := binary.LittleEndian.Uint16(data[i+26 : i+28])
+			extraLen := binary.LittleEndian.Uint16(data[i+28 : i+30])
+			if i+30+int(nameLen)+int(extraLen) == len(data) {
+				return bytes.Clone(data[i:]), nil
+			}
+		}
+		if window >= maxLocalHeaderSize || window == dataOffset {
+			return nil, fmt.Errorf("local file header for %s not found", f.Name)
+		}
+		window = maxLocalHeaderSize
+	}
+}
+
+// remoteReaderAt implements io.ReaderAt for remote ZIP file access. ReadAt
+// keeps no state of its own, so it may be called concurrently.
 type remoteReaderAt struct {
 	rzf *RemoteZipFile
+	ctx context.Context // nil for none
+
+	// probe, while set, is given the offset of each read instead of it
+	// being served
+	probe func(off int64)
 }
 
 func (r *remoteReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
-	data, err := r.rzf.getRange(off, off+int64(len(p)))
+	if r.probe != nil {
+		r.probe(off)
+		return 0, errProbe
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Reads running past the end are cut short here: the server would clip
+	// the window too, which fetchRangeRetry takes for a dropped connection
+	size := r.rzf.state().size
+	if off >= size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), size)
+	data, err := r.rzf.getRangeContext(ctx, off, end)
 	if err != nil {
 		return 0, err
 	}
-	copy(p, data)
-	return len(data), nil
+	// ReaderAt requires an error with a short read
+	n = copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
 }
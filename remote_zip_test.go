@@ -0,0 +1,543 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/unzip-http-go/internal/ziptest"
+)
+
+func TestSizeFromRangeGETWhenHeadRejected(t *testing.T) {
+	data := buildZip(t, testFile{name: "a.txt", body: "hello"})
+	srv := newTestServer(t, data)
+	srv.RejectHead = true
+
+	rzf := openTest(t, srv.URL)
+	if rzf.size != int64(len(data)) {
+		t.Fatalf("size = %d, want %d", rzf.size, len(data))
+	}
+	got, err := rzf.Extract("a.txt")
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("Extract = %q, %v", got, err)
+	}
+}
+
+func TestGzipEncodedRangeRejected(t *testing.T) {
+	zs := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: "hello"}))
+	var acceptEncoding atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			acceptEncoding.Store(r.Header.Get("Accept-Encoding"))
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		zs.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	_, err := NewRemoteZipFile(srv.URL, WithSmallFileThreshold(-1))
+	if err == nil || !strings.Contains(err.Error(), "Content-Encoding") {
+		t.Fatalf("got %v, want an error about the Content-Encoding", err)
+	}
+	if ae := acceptEncoding.Load(); ae != "" {
+		t.Errorf("range request sent Accept-Encoding %q", ae)
+	}
+}
+
+func TestDroppedConnectionResumes(t *testing.T) {
+	body := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(body)
+	srv := newTestServer(t, buildZip(t, testFile{name: "a.bin", body: string(body), method: zip.Deflate}))
+	srv.ShortBody = 500
+
+	rzf := openTest(t, srv.URL, WithRetry(100))
+	srv.ResetCounters()
+	got, err := rzf.Extract("a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("resumed contents differ")
+	}
+	if srv.RangeRequests() < 10 {
+		t.Errorf("%d range requests, want one per 500 bytes", srv.RangeRequests())
+	}
+}
+
+func TestWrongContentLengthCorrected(t *testing.T) {
+	data := buildZip(t, testFile{name: "a.txt", body: "hello"})
+	zs := newTestServer(t, data)
+	for _, lie := range []int{len(data) + 100, len(data) - 10} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.Header().Set("Accept-Ranges", "bytes")
+				w.Header().Set("Content-Length", strconv.Itoa(lie))
+				return
+			}
+			zs.Config.Handler.ServeHTTP(w, r)
+		}))
+
+		rzf := openTest(t, srv.URL)
+		if rzf.size != int64(len(data)) {
+			t.Errorf("Content-Length %d: size = %d, want %d", lie, rzf.size, len(data))
+		}
+		if got, err := rzf.Extract("a.txt"); err != nil || string(got) != "hello" {
+			t.Errorf("Content-Length %d: Extract = %q, %v", lie, got, err)
+		}
+		srv.Close()
+	}
+}
+
+// rawZip returns an archive holding name with the given compressed data,
+// method and CRC-32, written as is
+func rawZip(t *testing.T, name string, compressed []byte, method uint16, crc uint32, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	out, err := w.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             method,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(size),
+		Modified:           testModified,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Write(compressed)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestZstdEntries(t *testing.T) {
+	body := bytes.Repeat([]byte("zstandard "), 1000)
+	enc, _ := zstd.NewWriter(nil)
+	compressed := enc.EncodeAll(body, nil)
+	enc.Close()
+	crc := crc32.ChecksumIEEE(body)
+
+	srv := newTestServer(t, rawZip(t, "a.txt", compressed, zstd.ZipMethodWinZip, crc, len(body)))
+	got, err := openTest(t, srv.URL).Extract("a.txt")
+	if err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("Extract = %d bytes, %v", len(got), err)
+	}
+
+	srv = newTestServer(t, rawZip(t, "a.txt", compressed, zstd.ZipMethodWinZip, crc^1, len(body)))
+	if _, err := openTest(t, srv.URL).Extract("a.txt"); !errors.Is(err, zip.ErrChecksum) {
+		t.Errorf("with a wrong CRC-32: got %v, want zip.ErrChecksum", err)
+	}
+
+	// xz is not built in, and the error names the method
+	srv = newTestServer(t, rawZip(t, "a.txt", compressed, 95, crc, len(body)))
+	if _, err := openTest(t, srv.URL).Extract("a.txt"); !errors.Is(err, ErrUnsupportedMethod) || !strings.Contains(err.Error(), "95") {
+		t.Errorf("method 95: got %v, want ErrUnsupportedMethod naming it", err)
+	}
+}
+
+func TestPrependedData(t *testing.T) {
+	junk := bytes.Repeat([]byte{0x90}, 4096)
+	data := append(junk, buildZip(t,
+		testFile{name: "a.txt", body: "stored"},
+		testFile{name: "b.txt", body: strings.Repeat("deflated ", 50), method: zip.Deflate},
+	)...)
+	srv := newTestServer(t, data)
+
+	rzf := openTest(t, srv.URL)
+	if rzf.BaseOffset() != 4096 {
+		t.Errorf("BaseOffset = %d, want 4096", rzf.BaseOffset())
+	}
+	for name, want := range map[string]string{"a.txt": "stored", "b.txt": strings.Repeat("deflated ", 50)} {
+		if got, err := rzf.Extract(name); err != nil || string(got) != want {
+			t.Errorf("Extract(%q) = %q, %v", name, got, err)
+		}
+	}
+	header, err := rzf.LocalHeader("a.txt")
+	if err != nil || !bytes.HasPrefix(header, []byte("PK\x03\x04")) {
+		t.Errorf("LocalHeader = %q, %v", header, err)
+	}
+	if raw, err := rzf.ReadCompressed("a.txt"); err != nil || string(raw) != "stored" {
+		t.Errorf("ReadCompressed = %q, %v", raw, err)
+	}
+}
+
+func TestEmptyArchive(t *testing.T) {
+	srv := newTestServer(t, buildZip(t))
+
+	rzf := openTest(t, srv.URL)
+	if rzf.Files() == nil || len(rzf.Files()) != 0 || len(rzf.List()) != 0 || rzf.EntryCount() != 0 {
+		t.Errorf("Files = %v, List = %v, EntryCount = %d; want empty", rzf.Files(), rzf.List(), rzf.EntryCount())
+	}
+	if _, err := rzf.Extract("a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Extract: got %v, want ErrNotFound", err)
+	}
+	if _, err := rzf.Open("a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestEmptyArchiveCLI(t *testing.T) {
+	srv := newTestServer(t, buildZip(t))
+	_, stderr, code := runMain(t, t.TempDir(), srv.URL, "a.txt")
+	if code != 1 || !strings.Contains(stderr, "archive is empty") {
+		t.Errorf("exit code %d, stderr %q; want 1 and archive is empty", code, stderr)
+	}
+}
+
+func TestWrongContentRangeRejected(t *testing.T) {
+	data := buildZip(t, testFile{name: "a.txt", body: strings.Repeat("x", 200)})
+
+	for _, shift := range []int64{8, -8} {
+		srv := newTestServer(t, data)
+		srv.RangeShift = shift
+		_, err := NewRemoteZipFile(srv.URL, WithSmallFileThreshold(-1))
+		if err == nil || !strings.Contains(err.Error(), "for requested range") {
+			t.Errorf("window shifted by %d: got %v, want a range mismatch error", shift, err)
+		}
+	}
+
+	srv := newTestServer(t, data)
+	srv.ContentRange = "bytes garbage"
+	if _, err := NewRemoteZipFile(srv.URL, WithSmallFileThreshold(-1)); err == nil || !strings.Contains(err.Error(), "malformed Content-Range") {
+		t.Errorf("malformed Content-Range: got %v", err)
+	}
+
+	srv = newTestServer(t, data)
+	srv.IgnoreRange = true
+	if _, err := NewRemoteZipFile(srv.URL, WithSmallFileThreshold(-1)); !errors.Is(err, ErrRangeUnsupported) {
+		t.Errorf("Range ignored: got %v, want ErrRangeUnsupported", err)
+	}
+}
+
+func TestDataDescriptorEntries(t *testing.T) {
+	body := strings.Repeat("streamed ", 300)
+	// zip.Writer streams entries, leaving the sizes in the local header zero
+	// and writing them to a data descriptor after the data
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "a.txt", body: body, method: zip.Deflate},
+		testFile{name: "b.txt", body: body},
+	))
+	rzf := openTest(t, srv.URL)
+
+	for _, f := range rzf.Files() {
+		if f.Flags&0x8 == 0 {
+			t.Fatalf("%s has no data descriptor", f.Name)
+		}
+		header, err := rzf.LocalHeader(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if binary.LittleEndian.Uint32(header[18:]) != 0 || binary.LittleEndian.Uint32(header[22:]) != 0 {
+			t.Fatalf("%s: local header has nonzero sizes", f.Name)
+		}
+
+		if got, err := rzf.Extract(f.Name); err != nil || string(got) != body {
+			t.Errorf("Extract(%q) = %d bytes, %v", f.Name, len(got), err)
+		}
+		if got, err := rzf.ExtractRange(f.Name, 100, 50); err != nil || string(got) != body[100:150] {
+			t.Errorf("ExtractRange(%q) = %q, %v", f.Name, got, err)
+		}
+		raw, err := rzf.ReadCompressed(f.Name)
+		if err != nil || uint64(len(raw)) != f.CompressedSize64 {
+			t.Errorf("ReadCompressed(%q) = %d bytes, %v; want %d", f.Name, len(raw), err, f.CompressedSize64)
+		}
+		if f.Method == zip.Deflate {
+			inflated, err := io.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+			if err != nil || string(inflated) != body {
+				t.Errorf("ReadCompressed(%q) does not inflate to the contents: %v", f.Name, err)
+			}
+		}
+	}
+}
+
+func TestZip64OffsetsAbove4GB(t *testing.T) {
+	const offset = 5 << 30
+	body := bytes.Repeat([]byte("zip64 "), 100)
+	s := ziptest.NewSparse("big.bin", body, offset)
+	rzf, err := NewFromReaderAt(s, s.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rzf.Close()
+
+	header, err := rzf.LocalHeader("big.bin")
+	if err != nil || !bytes.HasPrefix(header, []byte("PK\x03\x04")) {
+		t.Fatalf("LocalHeader = %q, %v", header, err)
+	}
+	start, length, method, err := rzf.DownloadPlan("big.bin")
+	if err != nil || start != offset+int64(len(header)) || length != int64(len(body)) || method != zip.Store {
+		t.Errorf("DownloadPlan = %d, %d, %d, %v; want %d, %d, 0", start, length, method, err, offset+int64(len(header)), len(body))
+	}
+
+	var buf bytes.Buffer
+	if err := rzf.Repack(&buf, rzf.Files()); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("repacked entry = %d bytes, %v", len(got), err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "big.zip", time.Time{}, io.NewSectionReader(s, 0, s.Size()))
+	}))
+	defer srv.Close()
+	stdout, stderr, code := runMain(t, t.TempDir(), "--list-long", srv.URL)
+	if code != 0 {
+		t.Fatalf("--list-long: exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, strconv.FormatInt(start, 10)) {
+		t.Errorf("--list-long does not show offset %d:\n%s", start, stdout)
+	}
+}
+
+func TestOpenReaderAtConcurrentReads(t *testing.T) {
+	body := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(body)
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "big.bin", body: string(body)},
+		testFile{name: "small.txt", body: strings.Repeat("deflated ", 50), method: zip.Deflate},
+	))
+	rzf := openTest(t, srv.URL)
+
+	ra, err := rzf.OpenReaderAt("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra.Size() != int64(len(body)) {
+		t.Fatalf("Size = %d, want %d", ra.Size(), len(body))
+	}
+	const parts = 16
+	part := len(body) / parts
+	var wg sync.WaitGroup
+	for i := range parts {
+		wg.Go(func() {
+			p := make([]byte, part)
+			if n, err := ra.ReadAt(p, int64(i*part)); err != nil || n != part {
+				t.Errorf("part %d: ReadAt = %d, %v", i, n, err)
+			} else if !bytes.Equal(p, body[i*part:(i+1)*part]) {
+				t.Errorf("part %d differs", i)
+			}
+		})
+	}
+	wg.Wait()
+
+	if _, err := rzf.OpenReaderAt("small.txt"); err == nil {
+		t.Error("OpenReaderAt accepted a compressed entry")
+	}
+}
+
+func TestChunkedRangeResponses(t *testing.T) {
+	body := strings.Repeat("chunked ", 500)
+	zs := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: body, method: zip.Deflate}))
+	// Pass the range responses on without a Content-Length, flushing halfway
+	// so that net/http sends them chunked
+	var chunked atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		zs.Config.Handler.ServeHTTP(rec, r)
+		for k, v := range rec.Header() {
+			if k != "Content-Length" {
+				w.Header()[k] = v
+			}
+		}
+		w.WriteHeader(rec.Code)
+		data := rec.Body.Bytes()
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		w.Write(data[len(data)/2:])
+		if r.Method == http.MethodGet {
+			chunked.Add(1)
+		}
+	}))
+	defer srv.Close()
+
+	rzf := openTest(t, srv.URL)
+	if got, err := rzf.Extract("a.txt"); err != nil || string(got) != body {
+		t.Fatalf("Extract = %d bytes, %v", len(got), err)
+	}
+	if chunked.Load() == 0 {
+		t.Fatal("no chunked responses were sent")
+	}
+
+	// A read running past the end of the archive is short, with io.EOF
+	p := make([]byte, 100)
+	n, err := (&remoteReaderAt{rzf: rzf}).ReadAt(p, rzf.size-10)
+	if n != 10 || err != io.EOF {
+		t.Errorf("ReadAt past the end = %d, %v; want 10, io.EOF", n, err)
+	}
+}
+
+func TestNewestDuplicate(t *testing.T) {
+	// Three versions of a.txt, the newest in the middle, and two of b.txt
+	// with equal times
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range []struct {
+		name, body string
+		modified   time.Time
+	}{
+		{"a.txt", "first", testModified},
+		{"a.txt", "newest", testModified.Add(2 * time.Hour)},
+		{"a.txt", "older", testModified.Add(time.Hour)},
+		{"b.txt", "first", testModified},
+		{"b.txt", "tied", testModified},
+	} {
+		out, err := w.CreateHeader(&zip.FileHeader{Name: e.name, Modified: e.modified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write([]byte(e.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, buf.Bytes())
+
+	for _, tc := range []struct {
+		opts []Option
+		a, b string
+	}{
+		{nil, "first", "first"},
+		{[]Option{WithNewestDuplicate()}, "newest", "first"},
+	} {
+		rzf := openTest(t, srv.URL, tc.opts...)
+		for name, want := range map[string]string{"a.txt": tc.a, "b.txt": tc.b} {
+			if got, err := rzf.Extract(name); err != nil || string(got) != want {
+				t.Errorf("NewestDuplicate=%v: Extract(%q) = %q, %v; want %q", rzf.opts.NewestDuplicate, name, got, err, want)
+			}
+		}
+	}
+}
+
+func TestHostHeaderForIPv6Literal(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	zs := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: "hello"}))
+	var hosts sync.Map
+	srv := &httptest.Server{
+		Listener: ln,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hosts.Store(r.Host, true)
+			zs.Config.Handler.ServeHTTP(w, r)
+		})},
+	}
+	srv.Start()
+	defer srv.Close()
+	if !strings.HasPrefix(srv.URL, "http://[::1]:") {
+		t.Fatalf("server URL %s is not an IPv6 literal", srv.URL)
+	}
+
+	for _, tc := range []struct {
+		opts []Option
+		host string
+	}{
+		{nil, strings.TrimPrefix(srv.URL, "http://")},
+		{[]Option{WithHeader("Host", "example.test")}, "example.test"},
+	} {
+		hosts.Clear()
+		rzf := openTest(t, srv.URL, tc.opts...)
+		if got, err := rzf.Extract("a.txt"); err != nil || string(got) != "hello" {
+			t.Fatalf("Extract = %q, %v", got, err)
+		}
+		hosts.Range(func(host, _ any) bool {
+			if host != tc.host {
+				t.Errorf("request sent Host %q, want %q", host, tc.host)
+			}
+			return true
+		})
+	}
+}
+
+func TestDigestMatchesExtractedBytes(t *testing.T) {
+	// sha256sum of the body, computed independently of this package
+	const want = "7facbb2ee69c40c546c483f9a12b87b36c9968a4d6db3dc8a3699b6790526e01"
+	body := strings.Repeat("The quick brown fox jumps over the lazy dog\n", 1000)
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "a.txt", body: body, method: zip.Deflate},
+		testFile{name: "b.txt", body: body},
+	))
+	rzf := openTest(t, srv.URL)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		h := sha256.New()
+		n, err := rzf.Digest(name, h)
+		if err != nil || n != int64(len(body)) {
+			t.Fatalf("Digest(%q) = %d, %v; want %d", name, n, err, len(body))
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Errorf("Digest(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestRepackStreamsEntries(t *testing.T) {
+	body := make([]byte, 50000)
+	rand.New(rand.NewSource(1)).Read(body)
+	want := map[string]string{
+		"dir/":         "",
+		"dir/empty":    "",
+		"dir/a.bin":    string(body),
+		"dir/text.txt": strings.Repeat("deflated ", 500),
+	}
+	srv := newTestServer(t, buildZip(t,
+		testFile{name: "dir/"},
+		testFile{name: "dir/empty"},
+		testFile{name: "dir/a.bin", body: want["dir/a.bin"]},
+		testFile{name: "dir/text.txt", body: want["dir/text.txt"], method: zip.Deflate},
+	))
+	rzf := openTest(t, srv.URL)
+
+	var buf bytes.Buffer
+	if err := rzf.Repack(&buf, rzf.Files()); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("repacked %d entries, want %d", len(zr.File), len(want))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != want[f.Name] {
+			t.Errorf("%s: repacked contents differ (%v)", f.Name, err)
+		}
+	}
+}
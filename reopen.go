@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+)
+
+// archiveState is what Reopen replaces: everything a RemoteZipFile learned
+// about the archive, and the caches of its contents
+type archiveState struct {
+	size        int64
+	contentType string // as reported by the server, if any
+	baseOffset  int64
+	disks       DiskInfo
+	entryCount  int
+	files       []*zip.File
+	reader      *zip.Reader
+
+	// etag and lastModified are the validators the server reported when the
+	// size was determined, if any, for Changed
+	etag, lastModified string
+
+	// headerOffsets holds the local header offset of each of files
+	headerOffsets []int64
+
+	// dirOffset and dirSize locate the central directory in LowMemory mode,
+	// where reader and files are not populated
+	dirOffset, dirSize int64
+
+	// indexed is set once the central directory has been read
+	indexed bool
+
+	local    io.ReaderAt   // serves reads instead of fetcher when set
+	buffered bool          // local is a copy of the remote archive
+	gzipSize int64         // size of the remote archive local was gunzipped from
+	chunks   *chunkCache   // nil unless Options.ChunkSize is set
+	contents *contentCache // nil unless Options.ContentCacheSize is set
+}
+
+// Reopen refreshes a RemoteZipFile after the archive was updated on the
+// server, for long-running processes that would otherwise serve stale
+// offsets (see Changed). The size is determined and the central directory
+// read again, both with ctx, reusing the HTTP client and options, into a
+// new state with empty chunk, content, content type and OpenMany caches.
+// Other methods keep serving the previous state meanwhile, and may be
+// called concurrently: the new state is swapped in at once when it is
+// complete. If the updated archive cannot be read, the error is returned
+// and the previous state, caches included, is kept. Readers opened before
+// are invalid afterwards.
+func (rzf *RemoteZipFile) Reopen(ctx context.Context) error {
+	st := rzf.state()
+	next := rzf.loader()
+	if st.chunks != nil {
+		next.chunks = newChunkCache(rzf.opts.ChunkCacheSize)
+	}
+	if st.contents != nil {
+		next.contents = newContentCache(rzf.opts.ContentCacheSize)
+	}
+
+	// A ReaderAt passed to NewFromReaderAt is read again as it is
+	if st.local != nil && !st.buffered {
+		next.local, next.size = st.local, st.size
+	} else {
+		if err := next.loadSize(ctx); err != nil {
+			return err
+		}
+		next.bufferSmallArchive(ctx)
+	}
+	if err := next.LoadIndexContext(ctx); err != nil {
+		return err
+	}
+
+	rzf.mu.Lock()
+	rzf.archiveState = next.archiveState
+	rzf.sniffed.swap(nil)
+	rzf.spans.swap(nil)
+	rzf.mu.Unlock()
+	return nil
+}
+
+// loader returns a RemoteZipFile sharing the configuration, client, rate
+// limits and statistics of rzf but none of its archive state, for Reopen to
+// load a new state into while rzf goes on serving the current one
+func (rzf *RemoteZipFile) loader() *RemoteZipFile {
+	next := &RemoteZipFile{
+		URL:           rzf.URL,
+		httpClient:    rzf.httpClient,
+		opts:          rzf.opts,
+		fetcher:       rzf.fetcher,
+		stats:         rzf.stats,
+		requestLimit:  rzf.requestLimit,
+		byteLimit:     rzf.byteLimit,
+		decompressors: rzf.decompressors,
+		owner:         rzf,
+	}
+	// Range responses are checked against the size being loaded
+	if rzf.overHTTP() {
+		next.fetcher = httpFetcher{next}
+	}
+	return next
+}
+
+// state returns the current archive state. Reopen may replace it at any
+// time, so a method reads everything it needs from one snapshot.
+func (rzf *RemoteZipFile) state() archiveState {
+	rzf.mu.RLock()
+	defer rzf.mu.RUnlock()
+	return rzf.archiveState
+}
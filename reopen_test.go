@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReopenWhileReading(t *testing.T) {
+	big := strings.Repeat("stored ", 10000)
+	v1 := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: "one"}, testFile{name: "big.bin", body: big}))
+	v2 := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: "version two"}))
+	var current atomic.Pointer[http.Handler]
+	current.Store(&v1.Config.Handler)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		(*current.Load()).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	for _, opts := range [][]Option{nil, {WithChunkSize(4096, 16), WithContentCache(1 << 20)}} {
+		rzf := openTest(t, srv.URL, opts...)
+		current.Store(&v1.Config.Handler)
+		if err := rzf.Reopen(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Reopening an unchanged archive must not disturb the readers
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		for range 4 {
+			wg.Go(func() {
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if got, err := rzf.Extract("a.txt"); err != nil || string(got) != "one" {
+						t.Errorf("Extract = %q, %v", got, err)
+						return
+					}
+					ra, err := rzf.OpenReaderAt("big.bin")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					p := make([]byte, 700)
+					if _, err := ra.ReadAt(p, 7000); err != nil || !bytes.Equal(p, []byte(big[7000:7700])) {
+						t.Errorf("ReadAt = %q, %v", p, err)
+						return
+					}
+					if len(rzf.List()) != 2 || rzf.EntryCount() != 2 {
+						t.Errorf("List = %q", rzf.List())
+						return
+					}
+					rzf.Stats()
+				}
+			})
+		}
+		for range 20 {
+			if err := rzf.Reopen(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}
+		close(done)
+		wg.Wait()
+
+		current.Store(&v2.Config.Handler)
+		if err := rzf.Reopen(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := rzf.Extract("a.txt"); err != nil || string(got) != "version two" {
+			t.Errorf("after the update, Extract = %q, %v", got, err)
+		}
+	}
+}
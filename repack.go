@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// zip64ExtraID is the ZIP64 extended information extra field
+const zip64ExtraID = 0x0001
+
+// Repack writes a new archive to w holding files, which must come from
+// Files, in the given order. Each entry's compressed data is copied as is
+// (see ReadCompressed), so nothing is decompressed or recompressed and the
+// method, CRC-32, sizes, flags, times and extra fields carry over; the data
+// of an encrypted entry stays encrypted. A ZIP64 extra field is dropped,
+// since the offsets it may hold refer to the original archive; the writer
+// adds a new one where needed. w is not closed.
+func (rzf *RemoteZipFile) Repack(w io.Writer, files []*zip.File) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if err := rzf.repackFile(zw, f); err != nil {
+			return fmt.Errorf("failed to repack %s: %w", f.Name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// repackBufferSize is how much of an entry's compressed data Repack fetches
+// per range request
+const repackBufferSize = 4 << 20
+
+// repackFile copies the header and compressed data of f into zw, streaming
+// the data so that entries of any size are copied in constant memory
+func (rzf *RemoteZipFile) repackFile(zw *zip.Writer, f *zip.File) error {
+	offset, size, err := rzf.compressedRange(f)
+	if err != nil {
+		return err
+	}
+
+	fh := f.FileHeader
+	fh.Extra = withoutExtraField(f.Extra, zip64ExtraID)
+	out, err := zw.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	data := io.NewSectionReader(&remoteReaderAt{rzf: rzf}, offset, size)
+	_, err = io.CopyBuffer(out, data, make([]byte, min(size, repackBufferSize)))
+	return err
+}
+
+// withoutExtraField returns a copy of extra with every field of type tag
+// removed
+func withoutExtraField(extra []byte, tag uint16) []byte {
+	var out []byte
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if 4+size > len(extra) {
+			break
+		}
+		if id != tag {
+			out = append(out, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	return out
+}
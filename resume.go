@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// resumeBufferSize is how much of a stored entry ResumeExtract fetches per
+// range request
+const resumeBufferSize = 4 << 20
+
+// ResumeExtract writes the file name to path, continuing an earlier attempt
+// that was interrupted. For a stored entry, the bytes already in path are
+// kept and only the rest is fetched, from that offset within the entry's
+// data, and appended. Compressed and encrypted entries cannot be resumed
+// mid-stream, as decompression and decryption have to start at the
+// beginning, so a partial file of theirs is written again from scratch, as is a file longer than the entry. A
+// resumed or already complete file has its CRC-32 checked in full, and is
+// removed if it does not match. It returns the offset extraction resumed
+// from. Unlike ExtractMatching, path is written in place, so that an
+// interrupted attempt leaves something to resume.
+func (rzf *RemoteZipFile) ResumeExtract(name, path string) (int64, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return 0, err
+	}
+	return rzf.resumeExtract(f, path)
+}
+
+// resumeExtract is ResumeExtract for the entry f
+func (rzf *RemoteZipFile) resumeExtract(f *zip.File, path string) (int64, error) {
+	if f.FileInfo().IsDir() {
+		return 0, fmt.Errorf("%s is a directory", f.Name)
+	}
+	size := int64(f.UncompressedSize64)
+
+	var offset int64
+	st, err := os.Stat(path)
+	switch {
+	case err == nil && !st.Mode().IsRegular():
+		return 0, fmt.Errorf("refusing to write %s: not a regular file", path)
+	case err == nil:
+		offset = st.Size()
+	case !errors.Is(err, fs.ErrNotExist):
+		return 0, err
+	}
+	// The data of an encrypted entry is ciphertext, which like compressed
+	// data can only be decoded from the start
+	resumable := f.Method == zip.Store && f.Flags&0x1 == 0
+	if offset > 0 && !resumable && offset < size {
+		rzf.opts.logger().Info("compressed or encrypted entry cannot be resumed, restarting", "name", f.Name, "method", f.Method)
+	}
+	if !resumable || offset > size {
+		offset = 0
+	}
+	if offset == size && size > 0 {
+		if err := checkFileCRC(path, f); err == nil {
+			return offset, nil
+		}
+		offset = 0
+	}
+
+	if offset == 0 {
+		out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm(f))
+		if err != nil {
+			return 0, err
+		}
+		_, err = rzf.extractFileTo(f, out)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+	} else {
+		if err := rzf.appendStored(f, path, offset); err != nil {
+			return offset, fmt.Errorf("failed to resume %s: %w", f.Name, err)
+		}
+		if err := checkFileCRC(path, f); err != nil {
+			os.Remove(path)
+			return offset, err
+		}
+	}
+
+	if !f.Modified.IsZero() {
+		mtime, atime := fileTimes(f)
+		if err := os.Chtimes(path, atime, mtime); err != nil {
+			return offset, fmt.Errorf("failed to set times of %s: %w", path, err)
+		}
+	}
+	return offset, nil
+}
+
+// appendStored appends the data of f, a stored entry, from offset on to the
+// file at path
+func (rzf *RemoteZipFile) appendStored(f *zip.File, path string, offset int64) error {
+	section, err := rzf.storedSection(f)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+
+	// Hide ReadFrom so that the buffer size, and with it the size of each
+	// range request, is ours to choose
+	rest := io.NewSectionReader(section, offset, section.Size()-offset)
+	_, err = io.CopyBuffer(struct{ io.Writer }{out}, rest, make([]byte, resumeBufferSize))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkFileCRC compares the CRC-32 of the file at path with f's
+func checkFileCRC(path string, f *zip.File) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, in); err != nil {
+		return err
+	}
+	if h.Sum32() != f.CRC32 {
+		return fmt.Errorf("%w: %s has CRC-32 %08x, expected %08x", zip.ErrChecksum, path, h.Sum32(), f.CRC32)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResumeExtract(t *testing.T) {
+	body := strings.Repeat("resumable ", 1000)
+	srv := newTestServer(t, buildZip(t, testFile{name: "a.txt", body: body}))
+	rzf := openTest(t, srv.URL)
+
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte(body[:3000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := rzf.ResumeExtract("a.txt", path)
+	if err != nil || offset != 3000 {
+		t.Fatalf("ResumeExtract = %d, %v; want 3000", offset, err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != body {
+		t.Errorf("resumed file differs")
+	}
+}
+
+func TestResumeEncryptedStoredEntry(t *testing.T) {
+	body := strings.Repeat("secret contents ", 500)
+	srv := newTestServer(t, encryptedZip(t, "a.txt", body, zip.Store, "pw"))
+	rzf := openTest(t, srv.URL, WithPassword("pw"))
+
+	// The partial file holds plaintext, which the ciphertext in the archive
+	// cannot continue, so extraction starts over
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte(body[:3000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := rzf.ResumeExtract("a.txt", path)
+	if err != nil || offset != 0 {
+		t.Fatalf("ResumeExtract = %d, %v; want 0", offset, err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != body {
+		t.Errorf("extracted file = %d bytes, %v; want the decrypted contents", len(got), err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Limits set by SecurePreset
+const (
+	secureMaxEntries          = 10000
+	secureMaxDecompressedSize = 1 << 30
+	secureMaxCompressionRatio = 100
+	secureEOCDSearchSize      = 4096
+	secureMaxBufferedSize     = 64 << 20
+	secureMaxRedirects        = 3
+)
+
+// SecurePreset hardens a RemoteZipFile for archive URLs from untrusted
+// sources in one call. It sets:
+//
+//   - MaxEntries to 10,000
+//   - MaxDecompressedSize to 1 GiB
+//   - MaxCompressionRatio to 100
+//   - EOCDSearchSize to 4KB (the maximum window is still read once when
+//     the record is not found in it)
+//   - MaxBufferedSize to 64 MiB
+//   - MaxRedirects to 3
+//
+// Options are applied in order, so pass it first and follow it with any
+// option that should loosen or tighten one of these.
+func SecurePreset() Option {
+	return func(o *Options) {
+		o.MaxEntries = secureMaxEntries
+		o.MaxDecompressedSize = secureMaxDecompressedSize
+		o.MaxCompressionRatio = secureMaxCompressionRatio
+		o.EOCDSearchSize = secureEOCDSearchSize
+		o.MaxBufferedSize = secureMaxBufferedSize
+		o.MaxRedirects = secureMaxRedirects
+	}
+}
+
+// StrictPreset is SecurePreset plus Strict, which also refuses archives
+// containing symbolic links or names that could escape a destination
+// directory
+func StrictPreset() Option {
+	return func(o *Options) {
+		SecurePreset()(o)
+		o.Strict = true
+	}
+}
+
+// checkStrict refuses f under Options.Strict if it is a symbolic link or
+// its name is unsafe to use as a path
+func (rzf *RemoteZipFile) checkStrict(f *zip.File) error {
+	if !rzf.opts.Strict {
+		return nil
+	}
+	if f.Mode()&fs.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s is a symbolic link", ErrUnsafeEntry, f.Name)
+	}
+	if reason := unsafeName(f.Name); reason != "" {
+		return fmt.Errorf("%w: %q %s", ErrUnsafeEntry, f.Name, reason)
+	}
+	return nil
+}
+
+// unsafeName says why name could escape a destination directory when used
+// as a path, on any OS, or returns "" if it cannot
+func unsafeName(name string) string {
+	switch {
+	case name == "":
+		return "is empty"
+	case strings.ContainsRune(name, 0):
+		return "contains a NUL byte"
+	case strings.Contains(name, `\`):
+		return "contains a backslash"
+	case strings.HasPrefix(name, "/"):
+		return "is absolute"
+	case len(name) >= 2 && name[1] == ':':
+		return "starts with a drive letter"
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(name, "/"), "/") {
+		if part == ".." {
+			return `contains a ".." component`
+		}
+	}
+	return ""
+}
+
+// checkCompressionRatio refuses f if it declares a compression ratio above
+// Options.MaxCompressionRatio
+func (rzf *RemoteZipFile) checkCompressionRatio(f *zip.File) error {
+	if limit := rzf.ratioLimit(f); limit >= 0 && f.UncompressedSize64 > uint64(limit) {
+		return fmt.Errorf("%w: %s expands from %d to %d bytes, beyond a ratio of %g", ErrTooLarge, f.Name, f.CompressedSize64, f.UncompressedSize64, rzf.opts.MaxCompressionRatio)
+	}
+	return nil
+}
+
+// ratioLimit returns how many bytes f may decompress to under
+// Options.MaxCompressionRatio, or -1 if unlimited. Stored entries are not
+// limited.
+func (rzf *RemoteZipFile) ratioLimit(f *zip.File) int64 {
+	ratio := rzf.opts.MaxCompressionRatio
+	if ratio <= 0 || f.Method == zip.Store {
+		return -1
+	}
+	return int64(ratio * float64(max(f.CompressedSize64, 1)))
+}
+
+// maxLinkTarget bounds the symbolic link targets Readlink reads, at the
+// PATH_MAX of Linux
+const maxLinkTarget = 4096
+
+// Readlink returns the target of the symbolic link name, stored as the
+// entry's contents, without creating anything, so that the links of an
+// untrusted archive can be audited before extraction. It fails for entries
+// that are not symbolic links according to the Unix mode in their external
+// attributes, and for targets longer than any path. Under Strict, archives
+// with symbolic links are refused, so audit them without it.
+func (rzf *RemoteZipFile) Readlink(name string) (string, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return "", err
+	}
+	if f.Mode()&fs.ModeSymlink == 0 {
+		return "", fmt.Errorf("%s is not a symbolic link", f.Name)
+	}
+	if f.UncompressedSize64 > maxLinkTarget {
+		return "", fmt.Errorf("target of %s is %d bytes, longer than any path", f.Name, f.UncompressedSize64)
+	}
+
+	var target strings.Builder
+	if _, err := rzf.extractFileTo(f, &target); err != nil {
+		return "", err
+	}
+	return target.String(), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sniffLen is how much of an entry http.DetectContentType looks at
+const sniffLen = 512
+
+// sniffCache remembers the detected content type of each entry by name
+type sniffCache struct {
+	mu    sync.Mutex
+	types map[string]string
+}
+
+// swap replaces the cached types, returning the previous ones
+func (c *sniffCache) swap(types map[string]string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old := c.types
+	c.types = types
+	return old
+}
+
+// ContentType detects the MIME type of a file from its first 512 bytes of
+// decompressed data with http.DetectContentType, regardless of its name.
+// This costs one small range request per file (for a compressed file, as
+// much as the decompressor reads ahead, a few KB); the result is cached.
+// The detection recognizes images, audio, video, fonts, archives, PDF, HTML
+// and XML, but reports JSON, CSV and other text as "text/plain".
+func (rzf *RemoteZipFile) ContentType(name string) (string, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return "", err
+	}
+	return rzf.contentTypeOf(f)
+}
+
+func (rzf *RemoteZipFile) contentTypeOf(f *zip.File) (string, error) {
+	rzf.sniffed.mu.Lock()
+	ctype, ok := rzf.sniffed.types[f.Name]
+	rzf.sniffed.mu.Unlock()
+	if ok {
+		return ctype, nil
+	}
+
+	r, err := rzf.openFile(f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	buf := make([]byte, min(f.UncompressedSize64, sniffLen))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	ctype = http.DetectContentType(buf)
+
+	rzf.sniffed.mu.Lock()
+	if rzf.sniffed.types == nil {
+		rzf.sniffed.types = map[string]string{}
+	}
+	rzf.sniffed.types[f.Name] = ctype
+	rzf.sniffed.mu.Unlock()
+	return ctype, nil
+}
+
+// hasContentType reports whether the detected type of f starts with prefix,
+// e.g. "image/" or "application/pdf"
+func (rzf *RemoteZipFile) hasContentType(f *zip.File, prefix string) (bool, error) {
+	ctype, err := rzf.contentTypeOf(f)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(ctype, prefix), nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+)
+
+// spanSet holds byte ranges prefetched by OpenMany. Reads that fall
+// entirely within one are served from it until all of its readers are
+// closed.
+type spanSet struct {
+	mu    sync.Mutex
+	spans []*span
+}
+
+type span struct {
+	start int64
+	data  []byte
+	refs  int
+}
+
+// get returns a copy of [start, end) if a span covers it
+func (s *spanSet) get(start, end int64) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sp := range s.spans {
+		if start >= sp.start && end <= sp.start+int64(len(sp.data)) {
+			return bytes.Clone(sp.data[start-sp.start : end-sp.start]), true
+		}
+	}
+	return nil, false
+}
+
+func (s *spanSet) add(sp *span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spans = append(s.spans, sp)
+}
+
+// swap replaces the spans, returning the previous ones
+func (s *spanSet) swap(spans []*span) []*span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.spans
+	s.spans = spans
+	return old
+}
+
+// release drops n references to sp, forgetting it after the last
+func (s *spanSet) release(sp *span, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp.refs -= n
+	if sp.refs <= 0 {
+		s.spans = slices.DeleteFunc(s.spans, func(other *span) bool { return other == sp })
+	}
+}
+
+// maxDataDescriptorLen is the size of a ZIP64 data descriptor with its
+// optional signature
+const maxDataDescriptorLen = 24
+
+// errProbe aborts the reads made by probeHeaderOffsets
+var errProbe = errors.New("probing header offset")
+
+// probeHeaderOffsets learns where each file's local header starts, which
+// archive/zip keeps to itself, by letting DataOffset attempt to read the
+// header through ra and noting the offset instead of fetching anything. ra
+// must not be in use by anything else meanwhile.
+func probeHeaderOffsets(ra *remoteReaderAt, files []*zip.File) []int64 {
+	offsets := make([]int64, len(files))
+	for i, f := range files {
+		offsets[i] = -1
+		ra.probe = func(off int64) { offsets[i] = off }
+		f.DataOffset()
+	}
+	ra.probe = nil
+	return offsets
+}
+
+// headerOffset returns where f's local header starts, if known
+func (rzf *RemoteZipFile) headerOffset(f *zip.File) (int64, bool) {
+	st := rzf.state()
+	i := slices.Index(st.files, f)
+	if i < 0 || i >= len(st.headerOffsets) || st.headerOffsets[i] < 0 {
+		return 0, false
+	}
+	return st.headerOffsets[i], true
+}
+
+// OpenMany opens several files at once, fetching everything from the first
+// file's local header to the end of the last file's data with a single
+// range request and serving the files from that buffer. This suits a known
+// cluster of small files, such as a directory of configuration files;
+// files far apart make the span include everything in between, unless
+// Options.MultiRange has each file fetched as its own part of a single
+// multi-range request. The buffers are released once all returned readers
+// are closed. In LowMemory mode the files are opened one by one.
+func (rzf *RemoteZipFile) OpenMany(names []string) (map[string]io.ReadCloser, error) {
+	files := make(map[string]*zip.File, len(names))
+	for _, name := range names {
+		f, err := rzf.findFile(name)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = f
+	}
+
+	var spans map[string]*span
+	var err error
+	if rzf.opts.MultiRange {
+		spans, err = rzf.fetchFileSpans(files)
+	} else {
+		spans, err = rzf.fetchSpan(files)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make(map[string]io.ReadCloser, len(files))
+	for name, f := range files {
+		r, err := rzf.openFile(f)
+		if err != nil {
+			for _, r := range readers {
+				r.Close()
+			}
+			for name, sp := range spans {
+				if _, ok := readers[name]; !ok {
+					rzf.spans.release(sp, 1)
+				}
+			}
+			return nil, err
+		}
+		if sp, ok := spans[name]; ok {
+			readers[name] = &spanFileReader{fileReader: r, rzf: rzf, span: sp}
+		} else {
+			readers[name] = r
+		}
+	}
+	return readers, nil
+}
+
+// fileExtent returns the range of the archive holding f's local header,
+// data and data descriptor, if f's header offset is known. The local extra
+// field is assumed to be as long as the central one, which errs on the long
+// side for ZIP64 entries: only the central copy of their extended
+// information field holds the header offset. Should the local field be
+// longer, the tail of the data beyond the range is fetched separately.
+// archive/zip also reads the data descriptor, if any, that follows the data.
+func (rzf *RemoteZipFile) fileExtent(f *zip.File) (byteRange, bool) {
+	off, ok := rzf.headerOffset(f)
+	if !ok {
+		return byteRange{}, false
+	}
+	end := off + localHeaderReadSize + int64(len(f.Name)+len(f.Extra)) + int64(f.CompressedSize64)
+	if f.Flags&0x8 != 0 {
+		end += maxDataDescriptorLen
+	}
+	return byteRange{off, min(end, rzf.state().size)}, true
+}
+
+// fetchSpan fetches one span covering all of files, mapping each of their
+// names to it
+func (rzf *RemoteZipFile) fetchSpan(files map[string]*zip.File) (map[string]*span, error) {
+	var names []string
+	lo, hi := int64(-1), int64(0)
+	for name, f := range files {
+		r, ok := rzf.fileExtent(f)
+		if !ok {
+			continue
+		}
+		names = append(names, name)
+		if lo < 0 || r.start < lo {
+			lo = r.start
+		}
+		hi = max(hi, r.end)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	data, err := rzf.getRange(lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	sp := &span{start: lo, data: data, refs: len(names)}
+	rzf.spans.add(sp)
+
+	spans := make(map[string]*span, len(names))
+	for _, name := range names {
+		spans[name] = sp
+	}
+	return spans, nil
+}
+
+// fetchFileSpans fetches a span for each of files with getRanges
+func (rzf *RemoteZipFile) fetchFileSpans(files map[string]*zip.File) (map[string]*span, error) {
+	var names []string
+	var ranges []byteRange
+	for name, f := range files {
+		if r, ok := rzf.fileExtent(f); ok {
+			names = append(names, name)
+			ranges = append(ranges, r)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	data, err := rzf.getRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+	spans := make(map[string]*span, len(names))
+	for i, name := range names {
+		sp := &span{start: ranges[i].start, data: data[i], refs: 1}
+		rzf.spans.add(sp)
+		spans[name] = sp
+	}
+	return spans, nil
+}
+
+// spanFileReader releases its reference to the span it was opened from
+// when closed
+type spanFileReader struct {
+	*fileReader
+	rzf  *RemoteZipFile
+	span *span
+	once sync.Once
+}
+
+func (r *spanFileReader) Close() error {
+	r.once.Do(func() { r.rzf.spans.release(r.span, 1) })
+	return r.fileReader.Close()
+}
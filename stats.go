@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Stats reports the network and cache activity of a RemoteZipFile since it
+// was created, for tuning options such as ChunkSize against an archive's
+// access pattern
+type Stats struct {
+	// Requests is the number of HTTP requests sent, including size detection
+	Requests int64
+
+	// BytesFetched is the number of response body bytes received
+	BytesFetched int64
+
+	// CacheHits and CacheMisses count chunk lookups when ChunkSize is set.
+	// Each missing chunk counts once, even when a run of them is fetched
+	// with a single request.
+	CacheHits   int64
+	CacheMisses int64
+
+	// CacheEvictions counts chunks dropped to make room for newer ones
+	CacheEvictions int64
+
+	// BytesFromCache is the number of bytes served from cached chunks
+	// rather than from the response that fetched them
+	BytesFromCache int64
+
+	// ContentCacheHits and ContentCacheMisses count Extract calls served
+	// from and missing the content cache when ContentCacheSize is set
+	ContentCacheHits   int64
+	ContentCacheMisses int64
+}
+
+// CacheHitRatio returns the fraction of chunk lookups served from the
+// cache, or 0 if there were none
+func (s Stats) CacheHitRatio() float64 {
+	if s.CacheHits+s.CacheMisses == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+}
+
+// stats holds the counters behind Stats, updated concurrently by readers
+type stats struct {
+	requests       atomic.Int64
+	bytesFetched   atomic.Int64
+	cacheHits      atomic.Int64
+	cacheMisses    atomic.Int64
+	bytesFromCache atomic.Int64
+	contentHits    atomic.Int64
+	contentMisses  atomic.Int64
+}
+
+// Stats returns a snapshot of the counters
+func (rzf *RemoteZipFile) Stats() Stats {
+	s := Stats{
+		Requests:           rzf.stats.requests.Load(),
+		BytesFetched:       rzf.stats.bytesFetched.Load(),
+		CacheHits:          rzf.stats.cacheHits.Load(),
+		CacheMisses:        rzf.stats.cacheMisses.Load(),
+		BytesFromCache:     rzf.stats.bytesFromCache.Load(),
+		ContentCacheHits:   rzf.stats.contentHits.Load(),
+		ContentCacheMisses: rzf.stats.contentMisses.Load(),
+	}
+	if chunks := rzf.state().chunks; chunks != nil {
+		s.CacheEvictions = chunks.evictionCount()
+	}
+	return s
+}
+
+// do sends req, subject to RateLimit.RequestsPerSecond and counting it in
+// Stats
+func (rzf *RemoteZipFile) do(req *http.Request) (*http.Response, error) {
+	if err := rzf.requestLimit.wait(req.Context(), 1); err != nil {
+		return nil, err
+	}
+	rzf.stats.requests.Add(1)
+	resp, err := rzf.httpClient.Do(req)
+
+	log := rzf.opts.logger()
+	if err != nil {
+		log.Debug("request failed", "method", req.Method, "range", req.Header.Get("Range"), "error", err)
+	} else {
+		log.Debug("request", "method", req.Method, "range", req.Header.Get("Range"), "status", resp.StatusCode)
+	}
+	return resp, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"time"
+)
+
+// Extra field IDs carrying timestamps
+const (
+	ntfsExtraID    = 0x000a
+	extTimeExtraID = 0x5455
+)
+
+// ntfsEpochOffset is the number of 100ns ticks from 1601, the Windows
+// FILETIME epoch, to 1970
+const ntfsEpochOffset = 116444736000000000
+
+// EntryTimes are the timestamps recorded for an entry. Times the archive
+// does not record are zero.
+type EntryTimes struct {
+	Modified time.Time
+	Accessed time.Time
+	Created  time.Time
+}
+
+// Times returns a file's modification, access and creation times. The
+// modification time is the zip.File's own, for which archive/zip already
+// prefers the NTFS (0x000a), Extended Timestamp (0x5455) and Info-ZIP Unix
+// extra fields, in UTC, over the DOS time with its 2-second resolution and
+// unknown time zone; an NTFS time replaces it to keep its 100ns precision.
+// Access and creation times come from the same fields. Extended Timestamp
+// fields in the central directory usually omit them, in which case the
+// local header is fetched with one request.
+func (rzf *RemoteZipFile) Times(name string) (EntryTimes, error) {
+	f, err := rzf.findFile(name)
+	if err != nil {
+		return EntryTimes{}, err
+	}
+
+	t := EntryTimes{Modified: f.Modified}
+	if readExtraTimes(f.Extra, &t) {
+		header, err := rzf.localHeader(f)
+		if err != nil {
+			return t, err
+		}
+		nameLen := binary.LittleEndian.Uint16(header[26:28])
+		readExtraTimes(header[30+int(nameLen):], &t)
+	}
+	return t, nil
+}
+
+// fileTimes returns the modification and access times recorded in f's
+// central directory entry, the latter defaulting to the former, for
+// applying to extracted files
+func fileTimes(f *zip.File) (mtime, atime time.Time) {
+	t := EntryTimes{Modified: f.Modified}
+	readExtraTimes(f.Extra, &t)
+	if t.Accessed.IsZero() {
+		return t.Modified, t.Modified
+	}
+	return t.Modified, t.Accessed
+}
+
+// readExtraTimes fills in the times found in the extra fields in extra,
+// preferring NTFS times for their 100ns precision. It reports whether an
+// Extended Timestamp field flags times it does not hold, which are then only
+// in the local header's copy of the field.
+func readExtraTimes(extra []byte, t *EntryTimes) (inLocal bool) {
+	var ntfs bool
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		field := extra[:size]
+		extra = extra[size:]
+
+		switch id {
+		case ntfsExtraID:
+			// 4 reserved bytes, then tagged attributes; tag 1 holds the
+			// modification, access and creation times
+			if len(field) < 4 {
+				continue
+			}
+			attrs := field[4:]
+			for len(attrs) >= 4 {
+				tag := binary.LittleEndian.Uint16(attrs[0:2])
+				attrSize := int(binary.LittleEndian.Uint16(attrs[2:4]))
+				attrs = attrs[4:]
+				if attrSize > len(attrs) {
+					break
+				}
+				if tag == 1 && attrSize >= 24 {
+					if mtime := fileTime(attrs[0:8]); !mtime.IsZero() {
+						t.Modified = mtime
+					}
+					t.Accessed = fileTime(attrs[8:16])
+					t.Created = fileTime(attrs[16:24])
+					ntfs = true
+				}
+				attrs = attrs[attrSize:]
+			}
+
+		case extTimeExtraID:
+			// A flags byte, then a 32-bit Unix time for each of the
+			// modification, access and creation times it flags, in order
+			if len(field) < 1 {
+				continue
+			}
+			flags := field[0]
+			field = field[1:]
+			for bit := range 3 {
+				if flags&(1<<bit) == 0 {
+					continue
+				}
+				if len(field) < 4 {
+					inLocal = inLocal || bit > 0
+					continue
+				}
+				tm := time.Unix(int64(int32(binary.LittleEndian.Uint32(field))), 0).UTC()
+				field = field[4:]
+				switch {
+				case ntfs:
+				case bit == 1:
+					t.Accessed = tm
+				case bit == 2:
+					t.Created = tm
+				}
+			}
+		}
+	}
+	return inLocal && !ntfs
+}
+
+// fileTime converts a Windows FILETIME, or returns the zero time for 0
+func fileTime(b []byte) time.Time {
+	ticks := int64(binary.LittleEndian.Uint64(b))
+	if ticks == 0 {
+		return time.Time{}
+	}
+	ticks -= ntfsEpochOffset
+	return time.Unix(ticks/1e7, ticks%1e7*100).UTC()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zipCryptoHeaderSize is the length of the encryption header in front of
+// the data of an entry encrypted with traditional PKWARE encryption
+const zipCryptoHeaderSize = 12
+
+// aesMethod is the compression method recorded for WinZip AES entries
+const aesMethod = 99
+
+// zipCryptoKeys is the cipher state of traditional PKWARE encryption
+// (ZipCrypto), as specified in APPNOTE 6.1
+type zipCryptoKeys [3]uint32
+
+// newZipCryptoKeys returns the keys initialised with password
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xFF)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+// streamByte returns the next byte of the key stream
+func (k *zipCryptoKeys) streamByte() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+// decrypt decrypts buf in place
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i, c := range buf {
+		buf[i] = c ^ k.streamByte()
+		k.update(buf[i])
+	}
+}
+
+// crc32Update adds one byte to a CRC-32 the way ZipCrypto does, without
+// the pre- and post-conditioning of crc32.Update
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+// zipCryptoReader decrypts the data read from r
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (r *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.keys.decrypt(p[:n])
+	return n, err
+}
+
+// openEncrypted opens f, an encrypted entry, with Options.Password. The
+// last byte of the decrypted encryption header must match the entry's
+// CRC-32 (or, with a data descriptor, its modification time), which
+// catches all but one in 256 wrong passwords before any data is read; the
+// CRC-32 check at the end catches the rest. archive/zip cannot do this, so
+// the decompressor is chosen here.
+func (rzf *RemoteZipFile) openEncrypted(f *zip.File) (io.ReadCloser, error) {
+	if f.Method == aesMethod {
+		return nil, fmt.Errorf("%w: %s uses AES encryption, which is not supported", ErrEncrypted, f.Name)
+	}
+	if rzf.opts.Password == "" {
+		return nil, fmt.Errorf("%w: %s needs a password", ErrEncrypted, f.Name)
+	}
+	dcomp := rzf.decompressor(f.Method)
+	if dcomp == nil {
+		return nil, fmt.Errorf("%w %d for %s", ErrUnsupportedMethod, f.Method, f.Name)
+	}
+	if f.CompressedSize64 < zipCryptoHeaderSize {
+		return nil, fmt.Errorf("%s is too short to hold an encryption header", f.Name)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	keys := newZipCryptoKeys(rzf.opts.Password)
+	header := make([]byte, zipCryptoHeaderSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header of %s: %w", f.Name, err)
+	}
+	keys.decrypt(header)
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[zipCryptoHeaderSize-1] != check {
+		return nil, fmt.Errorf("%w for %s", ErrWrongPassword, f.Name)
+	}
+
+	rc := dcomp(&zipCryptoReader{r: raw, keys: keys})
+	return &checksumReader{rc: rc, f: f, hash: crc32.NewIEEE()}, nil
+}
+
+// decompressor returns the decompressor Open uses for method: one from
+// RegisterDecompressor or Options.Decompressors, or one of the built-in
+// store, deflate and zstd. It is nil for any other method.
+func (rzf *RemoteZipFile) decompressor(method uint16) zip.Decompressor {
+	if dcomp, ok := rzf.decompressors[method]; ok {
+		return dcomp
+	}
+	if dcomp, ok := rzf.opts.Decompressors[method]; ok {
+		return dcomp
+	}
+	switch method {
+	case zip.Store:
+		return io.NopCloser
+	case zip.Deflate:
+		return flate.NewReader
+	case zstd.ZipMethodWinZip:
+		return zstd.ZipDecompressor()
+	}
+	return nil
+}
+
+// checksumReader checks the data read from rc against f's CRC-32 at EOF,
+// as the readers archive/zip returns do
+type checksumReader struct {
+	rc   io.ReadCloser
+	f    *zip.File
+	hash hash.Hash32
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && r.f.CRC32 != 0 && r.hash.Sum32() != r.f.CRC32 {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+func (r *checksumReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// encryptedZip returns an archive holding body as name, compressed with
+// method and encrypted with password using ZipCrypto
+func encryptedZip(t *testing.T, name, body string, method uint16, password string) []byte {
+	t.Helper()
+	data := []byte(body)
+	if method == zip.Deflate {
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		fw.Write(data)
+		fw.Close()
+		data = buf.Bytes()
+	}
+
+	crc := crc32.ChecksumIEEE([]byte(body))
+	header := make([]byte, zipCryptoHeaderSize)
+	header[zipCryptoHeaderSize-1] = byte(crc >> 24)
+	plain := append(header, data...)
+	keys := newZipCryptoKeys(password)
+	cipher := make([]byte, len(plain))
+	for i, p := range plain {
+		cipher[i] = p ^ keys.streamByte()
+		keys.update(p)
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             method,
+		Flags:              0x1,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(cipher)),
+		UncompressedSize64: uint64(len(body)),
+		Modified:           testModified,
+	}
+	out, err := w.CreateRaw(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Write(cipher)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWithPasswordDecryptsZipCrypto(t *testing.T) {
+	body := string(bytes.Repeat([]byte("secret contents "), 100))
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		srv := newTestServer(t, encryptedZip(t, "a.txt", body, method, "hunter2"))
+
+		rzf := openTest(t, srv.URL, WithPassword("hunter2"))
+		got, err := rzf.Extract("a.txt")
+		if err != nil {
+			t.Fatalf("method %d: %v", method, err)
+		}
+		if string(got) != body {
+			t.Fatalf("method %d: decrypted contents differ", method)
+		}
+
+		// Seeking back reopens the entry, which must decrypt again
+		rc, err := rzf.Open("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.CopyN(io.Discard, rc, 100)
+		if _, err := rc.(io.Seeker).Seek(16, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		rest, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(rest) != body[16:] {
+			t.Fatalf("method %d: read after seek = %d bytes, %v", method, len(rest), err)
+		}
+	}
+}
+
+func TestEncryptedEntryErrors(t *testing.T) {
+	srv := newTestServer(t, encryptedZip(t, "a.txt", "secret", zip.Deflate, "hunter2"))
+
+	if _, err := openTest(t, srv.URL).Extract("a.txt"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("without a password: got %v, want ErrEncrypted", err)
+	}
+	if _, err := openTest(t, srv.URL, WithPassword("wrong")).Extract("a.txt"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("with a wrong password: got %v, want ErrWrongPassword", err)
+	}
+	if _, err := openTest(t, srv.URL, WithPassword("hunter2")).OpenReaderAt("a.txt"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("OpenReaderAt: got %v, want ErrEncrypted", err)
+	}
+}